@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// AnswersFileName is a file in the current directory where values used for
+// generating files are stored
+const AnswersFileName = ".sttemp-answers.json"
+
+// Answers keeps everything we need to render generated files again
+type Answers struct {
+	Templates []Answer `json:"templates"`
+}
+
+// Answer is a record about one generated file
+type Answer struct {
+	// name of the template
+	Template string `json:"template"`
+	// file, which was generated from the template
+	Output string `json:"output"`
+	// hash of template's content at the moment of generation
+	Hash string `json:"hash"`
+	// values of the template's variables
+	Values map[string]string `json:"values"`
+	// hash of the generated content, --update doesn't overwrite the file,
+	// if it was changed after generation
+	OutputHash string `json:"output_hash"`
+}
+
+func loadAnswers(ioh *IOHandler) (*Answers, error) {
+	content, err := ioh.ReadFile(AnswersFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Answers{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	answers := new(Answers)
+	if err := json.Unmarshal(content, answers); err != nil {
+		return nil, err
+	}
+	return answers, nil
+}
+
+func (a *Answers) save(ioh *IOHandler) error {
+	content, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioh.Create(AnswersFileName, DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// record adds answer or replaces the old one for the same output file.
+// Outputs of commands, computed values and secrets are not recorded, they
+// are computed or asked again on every rendering.
+func (a *Answers) record(template *engine.Template, answer Answer) {
+	answer.Values = withoutCommands(answer.Values)
+	maps.DeleteFunc(answer.Values, func(name string, _ string) bool {
+		return template.IsComputed(name) || template.IsSecret(name)
+	})
+	a.add(answer)
+}
+
+// merge adds all answers from other, they replace old answers for the same
+// output files
+func (a *Answers) merge(other *Answers) {
+	for _, answer := range other.Templates {
+		a.add(answer)
+	}
+}
+
+func (a *Answers) add(answer Answer) {
+	for i, old := range a.Templates {
+		if old.Output == answer.Output {
+			a.Templates[i] = answer
+			return
+		}
+	}
+	a.Templates = append(a.Templates, answer)
+}
+
+// withoutCommands returns values of variables without outputs of commands,
+// commands are run again on every rendering
+func withoutCommands(values map[string]string) map[string]string {
+	result := maps.Clone(values)
+	maps.DeleteFunc(result, func(name string, _ string) bool {
+		_, ok := engine.Command(name)
+		return ok
+	})
+	return result
+}
+
+// outputHash returns hash of the generated file's content
+func outputHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// isArchive reports, whether templates should be read from the archive
+// instead of the directory
+func isArchive(path string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openArchive returns file system with templates from zip or tar archive
+func openArchive(ioh *IOHandler, path string) (fs.FS, error) {
+	content, err := ioh.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(path, ".zip") {
+		return zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	}
+
+	var reader io.Reader = bytes.NewReader(content)
+	if !strings.HasSuffix(path, ".tar") {
+		reader, err = gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tarToZip(tar.NewReader(reader))
+}
+
+// tarToZip repacks tar archive into zip in memory, because archive/tar
+// can't be used as fs.FS
+func tarToZip(reader *tar.Reader) (fs.FS, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// keep permissions, executable templates make executable files
+		zipHeader, err := zip.FileInfoHeader(header.FileInfo())
+		if err != nil {
+			return nil, err
+		}
+		zipHeader.Name = strings.TrimPrefix(header.Name, "./")
+		zipHeader.Method = zip.Deflate
+		file, err := writer.CreateHeader(zipHeader)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
@@ -0,0 +1,22 @@
+//go:build bundle
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Build with "go build -tags bundle" to put templates from the templates
+// directory into the binary
+//
+//go:embed all:templates
+var bundle embed.FS
+
+func init() {
+	var err error
+	bundledTemplates, err = fs.Sub(bundle, "templates")
+	if err != nil {
+		panic(err)
+	}
+}
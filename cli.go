@@ -1,84 +1,478 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"maps"
+	"io"
+	"io/fs"
+	"path/filepath"
 	"slices"
 	"strings"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// commands, which can be used before template names
+const (
+	InspectCommand = "inspect"
+	VarsCommand    = "vars"
+	LintCommand    = "lint"
+	PackCommand    = "pack"
 )
 
+var commands = []string{InspectCommand, VarsCommand, LintCommand, PackCommand}
+
+// DefaultDirMode is used for missing directories of output files
+const DefaultDirMode fs.FileMode = 0o755
+
+// DefaultFileMode is used for files, which are not generated from
+// templates, the same as in os.Create
+const DefaultFileMode fs.FileMode = 0o666
+
+// splitCommand separates command from its arguments, if the first argument
+// is a command
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 && slices.Contains(commands, args[0]) {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
 // CliState represents the state of the running app with all options set
 // and keep all business logic inside its functions
 type CliState struct {
 	outputFileName string
 	defaultName    bool
+	// arguments of pack command are stored here too
 	templateNames  []string
-	storage        *Storage
+	storage        *engine.Storage
+	readOnly       bool
 	noInput        bool
 	ioh            *IOHandler
 	editMode       bool
 	listTemplates  bool
+	noRecord       bool
+	updateMode     bool
+	command        string
+	jsonOutput     bool
+	strict         bool
+	rawBackslashes bool
+	noMkdir        bool
+	noHooks        bool
+	allowExec      bool
+	// prefix of environment variables with values
+	envPrefix string
+	noEnv     bool
+	// --update overwrites files, which were changed after generation
+	force bool
+	// permissions of created directories, DefaultDirMode if it is zero
+	dirMode fs.FileMode
 }
 
 func (cs *CliState) Run() error {
+	if cs.command == PackCommand {
+		return cs.pack(cs.templateNames)
+	}
+
 	if err := cs.validateState(); err != nil {
 		return err
 	}
 
+	if cs.updateMode {
+		return cs.update()
+	}
+
+	if cs.command == InspectCommand {
+		return cs.inspect()
+	}
+
+	if cs.command == VarsCommand {
+		return cs.vars()
+	}
+
+	if cs.command == LintCommand {
+		return cs.lint()
+	}
+
 	if cs.editMode {
 		editor, ok := cs.ioh.LookupEnv("EDITOR")
 		if !ok {
 			editor = "vi"
 		}
 
-		templateFile := cs.storage.templates[cs.templateNames[0]]
+		templateFile, err := cs.storage.Lookup(cs.templateNames[0])
+		if err != nil {
+			return err
+		}
 		return cs.ioh.executeCommand(editor, templateFile.Path)
 	}
 
 	// if no templates specified or -l flag is set, list templates
 	if len(cs.templateNames) == 0 || cs.listTemplates {
-		templates := slices.Collect(maps.Values(cs.storage.templates))
-		slices.SortFunc(templates, func(a, b TemplateFile) int {
-			return strings.Compare(a.Name, b.Name)
-		})
+		templates := cs.storage.Templates()
+		if cs.jsonOutput {
+			return cs.listJSON(templates)
+		}
 		for _, templateFile := range templates {
 			if cs.listTemplates {
 				fmt.Fprintln(cs.ioh.Stdout, templateFile.Name)
-			} else {
-				fmt.Fprintln(cs.ioh.Stdout, templateFile)
+				continue
+			}
+
+			// default name can be declared in the template's header, a
+			// broken template doesn't hide the rest
+			template, err := cs.loadTemplate(templateFile.Name)
+			if err != nil {
+				fmt.Fprintln(cs.ioh.Stderr, err)
+				continue
 			}
+			fmt.Fprintln(cs.ioh.Stdout, template)
 		}
 		return nil
 	}
 
+	// resolve all values before writing anything, so with --no-input
+	// user gets all missing variables at once
+	templates := make([]*engine.Template, 0, len(cs.templateNames))
+	allValues := make([]map[string]string, 0, len(cs.templateNames))
+	outputs := make([]string, 0, len(cs.templateNames))
+	withHooks := make([]bool, 0, len(cs.templateNames))
+	missing := new(engine.MissingVariablesError)
+	lintErr := new(engine.LintError)
 	for _, name := range cs.templateNames {
-		templateFile := cs.storage.templates[name]
-		content, err := cs.ioh.ReadFile(templateFile.Path)
+		template, err := cs.loadTemplate(name)
+		if err != nil {
+			return err
+		}
+
+		if cs.defaultName && template.DefaultName == "" {
+			return fmt.Errorf("template %s has no default name, but -d flag was set", template.Name)
+		}
+
+		if cs.strict {
+			issues, err := cs.storage.Lint(template)
+			if err != nil {
+				return err
+			}
+			lintErr.Issues = append(lintErr.Issues, issues...)
+		}
+
+		// output name can have placeholders too
+		output := cs.getOutputName(template)
+		source := "-o " + output
+		if cs.defaultName {
+			source = "output " + output
+		}
+		if err := template.UsePath(output, source); err != nil {
+			return fmt.Errorf("output %s: %w", output, err)
+		}
+
+		// hooks are run only for generated files, not for stdout
+		runHooks := output != "" && !cs.noHooks
+		commands := slices.Concat(template.Metadata.ValuesCommands, secretCommands(template), cs.commandPlaceholders(template))
+		if runHooks {
+			commands = append(commands, template.Metadata.Hooks...)
+		}
+		allow, err := cs.allowCommands(template, commands)
+		if err != nil {
+			return err
+		}
+
+		var computed map[string]string
+		if allow && len(template.Metadata.ValuesCommands) > 0 {
+			computed, err = cs.computeValues(template)
+			if err != nil {
+				return err
+			}
+		}
+
+		values, err := engine.ResolveValues(template, nil, cs.resolver(template, computed, allow))
+		var templateMissing *engine.MissingVariablesError
+		if errors.As(err, &templateMissing) {
+			missing.Variables = append(missing.Variables, templateMissing.Variables...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		templates = append(templates, template)
+		allValues = append(allValues, values)
+		outputs = append(outputs, template.ExpandPath(output, values))
+		withHooks = append(withHooks, allow && runHooks)
+	}
+
+	if len(lintErr.Issues) > 0 {
+		return lintErr
+	}
+
+	if len(missing.Variables) > 0 {
+		return &noInputError{missing, cs.envNamer()}
+	}
+
+	generated := new(Answers)
+	for i, template := range templates {
+		file, err := cs.getOutputFile(outputs[i], template)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		err = writeOutput(file, func(w io.Writer) error {
+			return cs.storage.Render(io.MultiWriter(w, hash), template, allValues[i])
+		})
+		if err != nil {
+			return err
+		}
+
+		if outputs[i] != "" {
+			generated.record(template, Answer{
+				Template:   template.Name,
+				Output:     outputs[i],
+				Hash:       template.Hash,
+				Values:     allValues[i],
+				OutputHash: hex.EncodeToString(hash.Sum(nil)),
+			})
+		}
+	}
+
+	// values of generated files are recorded, so they can be updated later
+	if !cs.noRecord && len(generated.Templates) > 0 {
+		answers, err := loadAnswers(cs.ioh)
+		if err != nil {
+			return err
+		}
+		answers.merge(generated)
+		if err := answers.save(cs.ioh); err != nil {
+			return err
+		}
+	}
+
+	for i, template := range templates {
+		if !withHooks[i] {
+			continue
+		}
+		if err := cs.runHooks(template, outputs[i], allValues[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update renders again all files from the answers file, which templates
+// were changed since the last generation
+func (cs *CliState) update() error {
+	answers, err := loadAnswers(cs.ioh)
+	if err != nil {
+		return err
+	}
+
+	if len(answers.Templates) == 0 {
+		return fmt.Errorf("nothing to update, %s has no records", AnswersFileName)
+	}
+
+	for _, answer := range answers.Templates {
+		if _, err := cs.storage.Lookup(answer.Template); err != nil {
+			return fmt.Errorf("%s: %w", AnswersFileName, err)
+		}
+
+		// template is read into memory to show a diff
+		template, err := cs.readTemplate(answer.Template)
+		if err != nil {
+			return err
+		}
+
+		hash := template.Hash
+		if hash == answer.Hash {
+			fmt.Fprintf(cs.ioh.Stderr, "%s is up to date\n", answer.Output)
+			continue
+		}
+
+		oldContent, err := cs.ioh.ReadFile(answer.Output)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		// local changes are not lost
+		if outputHash(oldContent) != answer.OutputHash && !cs.force {
+			fmt.Fprintf(cs.ioh.Stderr, "%s was changed after generation, it is skipped, use --force to overwrite it\n", answer.Output)
+			continue
+		}
+
+		allow, err := cs.allowCommands(template, slices.Concat(secretCommands(template), cs.commandPlaceholders(template)))
+		if err != nil {
+			return err
+		}
+
+		// reuse recorded values, ask only for new variables and secrets
+		values, err := engine.ResolveValues(template, answer.Values, cs.resolver(template, nil, allow))
+		var missing *engine.MissingVariablesError
+		if errors.As(err, &missing) {
+			return &noInputError{missing, cs.envNamer()}
+		}
+		if err != nil {
+			return err
+		}
+
+		result := template.Fill(values)
+		diff := unifiedDiff("a/"+answer.Output, "b/"+answer.Output, string(oldContent), result)
+		fmt.Fprint(cs.ioh.Stdout, maskSecrets(template, values, diff))
+
+		file, err := cs.createFile(answer.Output, template)
+		if err != nil {
+			return err
+		}
+
+		err = writeOutput(file, func(w io.Writer) error {
+			_, err := io.WriteString(w, result)
+			return err
+		})
 		if err != nil {
 			return err
 		}
 
-		template := NewTemplate(&templateFile, content)
+		answers.record(template, Answer{
+			Template:   answer.Template,
+			Output:     answer.Output,
+			Hash:       hash,
+			Values:     values,
+			OutputHash: outputHash([]byte(result)),
+		})
+	}
+
+	return answers.save(cs.ioh)
+}
 
-		file, err := cs.getOutputFile(template)
+func (cs *CliState) inspect() error {
+	template, err := cs.loadTemplate(cs.templateNames[0])
+	if err != nil {
+		return err
+	}
+
+	info := NewTemplateInfo(template)
+	if cs.jsonOutput {
+		return writeJSON(cs.ioh.Stdout, info)
+	}
+
+	info.writeText(cs.ioh.Stdout)
+	return nil
+}
+
+func (cs *CliState) vars() error {
+	template, err := cs.loadTemplate(cs.templateNames[0])
+	if err != nil {
+		return err
+	}
+
+	// values commands are run with the same rules as before rendering
+	allow, err := cs.allowCommands(template, slices.Concat(template.Metadata.ValuesCommands, secretCommands(template)))
+	if err != nil {
+		return err
+	}
+	var computed map[string]string
+	if allow && len(template.Metadata.ValuesCommands) > 0 {
+		computed, err = cs.computeValues(template)
 		if err != nil {
 			return err
 		}
+	}
+
+	info := NewTemplateInfo(template)
+	statuses := NewVariableStatuses(info, cs.lookupVariable, computed, allow)
+	if cs.jsonOutput {
+		return writeJSON(cs.ioh.Stdout, statuses)
+	}
+
+	return writeVariableStatuses(cs.ioh.Stdout, statuses)
+}
+
+// lint prints issues for selected templates, or for all templates if none
+// were selected
+func (cs *CliState) lint() error {
+	names := cs.templateNames
+	if len(names) == 0 {
+		for _, templateFile := range cs.storage.Templates() {
+			names = append(names, templateFile.Name)
+		}
+	}
 
-		values, err := cs.ioh.getVariableValues(template, cs.noInput)
+	issues := make([]engine.LintIssue, 0)
+	for _, name := range names {
+		template, err := cs.loadTemplate(name)
 		if err != nil {
 			return err
 		}
 
-		fmt.Fprint(file, template.fillTemplate(values))
-		if err := file.Close(); err != nil {
+		templateIssues, err := cs.storage.Lint(template)
+		if err != nil {
 			return err
 		}
+		issues = append(issues, templateIssues...)
 	}
 
+	if cs.jsonOutput {
+		if err := writeJSON(cs.ioh.Stdout, issues); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Fprintln(cs.ioh.Stdout, issue)
+		}
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("found %d issues in templates", len(issues))
+	}
 	return nil
 }
 
+func (cs *CliState) listJSON(templates []engine.TemplateFile) error {
+	infos := make([]TemplateInfo, 0, len(templates))
+	for _, templateFile := range templates {
+		template, err := cs.loadTemplate(templateFile.Name)
+		if err != nil {
+			fmt.Fprintln(cs.ioh.Stderr, err)
+			continue
+		}
+		infos = append(infos, NewTemplateInfo(template))
+	}
+	return writeJSON(cs.ioh.Stdout, infos)
+}
+
+func (cs *CliState) templateFile(name string) (engine.TemplateFile, error) {
+	templateFile, err := cs.storage.Lookup(name)
+	if err != nil {
+		return templateFile, err
+	}
+	if cs.rawBackslashes {
+		templateFile.DirMetadata = (&engine.Metadata{RawBackslashes: true}).Merge(templateFile.DirMetadata)
+	}
+	return templateFile, nil
+}
+
+// loadTemplate reads template's metadata and variables without keeping its
+// content in memory
+func (cs *CliState) loadTemplate(name string) (*engine.Template, error) {
+	templateFile, err := cs.templateFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return cs.storage.Load(&templateFile)
+}
+
+// readTemplate reads the whole template into memory
+func (cs *CliState) readTemplate(name string) (*engine.Template, error) {
+	templateFile, err := cs.templateFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return cs.storage.Read(&templateFile)
+}
+
 func (cs *CliState) validateState() error {
 	if cs.defaultName && cs.outputFileName != "" {
 		return fmt.Errorf("both -d and -o flags were set, but only one of them can be used at the same time")
@@ -92,28 +486,184 @@ func (cs *CliState) validateState() error {
 		return fmt.Errorf("edit mode was set, but too many template names were provided")
 	}
 
+	if cs.editMode && cs.readOnly {
+		return fmt.Errorf("edit mode was set, but templates from %s can't be edited", cs.storage.Dir())
+	}
+
+	if cs.command != "" && cs.command != LintCommand && len(cs.templateNames) != 1 {
+		return fmt.Errorf("%s command needs exactly one template name", cs.command)
+	}
+
+	isListing := cs.command == "" && (len(cs.templateNames) == 0 || cs.listTemplates)
+	if cs.jsonOutput && !isListing && cs.command == "" {
+		return fmt.Errorf("--json can be used only for listing templates or with commands")
+	}
+
+	if cs.updateMode && (len(cs.templateNames) != 0 || cs.defaultName || cs.outputFileName != "" || cs.editMode || cs.listTemplates) {
+		return fmt.Errorf("--update renders files from %s and cannot be used with template names or other modes", AnswersFileName)
+	}
+
+	if cs.force && !cs.updateMode {
+		return fmt.Errorf("--force can be used only with --update")
+	}
+
 	for _, name := range cs.templateNames {
-		templateFile, ok := cs.storage.templates[name]
+		if _, err := cs.storage.Lookup(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolver returns output of commands for command placeholders, and values
+// from the environment, secrets, computed values and user's input for
+// variables. allowCommands reports, whether commands of the template were
+// allowed by allowCommands.
+func (cs *CliState) resolver(template *engine.Template, computed map[string]string, allowCommands bool) engine.Resolver {
+	resolve := cs.ioh.resolver(cs.lookupVariable, cs.noInput, computed)
+	return func(variable engine.VariableMetadata) (string, error) {
+		// environment overrides secrets, e.g. in CI
+		_, inEnv := cs.lookupVariable(variable.Name)
+		fromSecret := variable.SecretFile != "" || (variable.SecretCommand != "" && allowCommands)
+		if fromSecret && !inEnv {
+			return cs.readSecret(variable)
+		}
+
+		command, ok := engine.Command(variable.Name)
 		if !ok {
-			return fmt.Errorf("template %s not found", name)
+			return resolve(variable)
+		}
+		if !cs.allowExec {
+			return "", fmt.Errorf("commands in templates are run only with --allow-exec")
+		}
+		if template.Namespace() != "" && !allowCommands {
+			return "", fmt.Errorf("commands of templates from pack %s are run only after confirmation", template.Namespace())
 		}
 
-		if cs.defaultName && templateFile.DefaultName == "" {
-			return fmt.Errorf("template %s has no default name, but -d flag was set", templateFile.Name)
+		output, err := cs.ioh.captureCommand("sh", "-c", command)
+		if err != nil {
+			return "", err
 		}
+		// the same as in shell's command substitution
+		return strings.TrimRight(string(output), "\n"), nil
 	}
+}
 
-	return nil
+// lookupVariable returns value of the variable from the environment, see
+// envName
+func (cs *CliState) lookupVariable(name string) (string, bool) {
+	if cs.noEnv {
+		return "", false
+	}
+	return cs.ioh.LookupEnv(envName(cs.envPrefix, name))
+}
+
+// envNamer returns function for names of environment variables, or nil if
+// --no-env is set
+func (cs *CliState) envNamer() func(name string) string {
+	if cs.noEnv {
+		return nil
+	}
+	return func(name string) string {
+		return envName(cs.envPrefix, name)
+	}
 }
 
-func (cs *CliState) getOutputFile(template *Template) (OutputFile, error) {
+// getOutputName returns name of the output file, it can contain
+// placeholders, see engine.Template.ExpandPath
+func (cs *CliState) getOutputName(template *engine.Template) string {
 	if cs.defaultName {
-		return cs.ioh.Create(template.DefaultName)
+		return template.DefaultName
 	}
 
-	if cs.outputFileName != "" {
-		return cs.ioh.Create(cs.outputFileName)
+	return cs.outputFileName
+}
+
+func (cs *CliState) getOutputFile(name string, template *engine.Template) (OutputFile, error) {
+	if name != "" {
+		return cs.createFile(name, template)
 	}
 
 	return StdoutInstance(cs.ioh.Stdout), nil
 }
+
+// writeOutput writes to the file through a buffer, rendering writes every
+// token separately, and closes the file
+func writeOutput(file OutputFile, write func(w io.Writer) error) error {
+	buffered := bufio.NewWriter(file)
+	err := write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// createFile creates the file for the template and its missing parent
+// directories, unless --no-mkdir is set
+func (cs *CliState) createFile(name string, template *engine.Template) (OutputFile, error) {
+	if !cs.noMkdir {
+		if err := cs.createParents(filepath.Dir(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := cs.ioh.Create(name, template.FileMode())
+	if err != nil {
+		return nil, err
+	}
+	// permissions are changed before writing, so secrets are never in a
+	// readable file
+	if err := cs.setFileMode(name, template); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// setFileMode sets permissions of the existing file, Create sets them only
+// for new files. Declared mode is set as is, executable templates make the
+// file executable, where it is readable, like chmod +x.
+func (cs *CliState) setFileMode(name string, template *engine.Template) error {
+	switch {
+	case template.Metadata.Mode != 0:
+		return cs.ioh.Chmod(name, template.Metadata.Mode)
+	case template.Mode&0o111 != 0:
+		info, err := cs.ioh.Stat(name)
+		if err != nil {
+			return err
+		}
+		perm := info.Mode().Perm()
+		return cs.ioh.Chmod(name, perm|(perm&0o444)>>2)
+	}
+	return nil
+}
+
+// createParents creates dir and all missing directories above it, and
+// reports every created directory
+func (cs *CliState) createParents(dir string) error {
+	var missing []string
+	for ; dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		_, err := cs.ioh.Stat(dir)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		missing = append(missing, dir)
+	}
+
+	mode := cmp.Or(cs.dirMode, DefaultDirMode)
+	for _, dir := range slices.Backward(missing) {
+		if err := cs.ioh.Mkdir(dir, mode); err != nil {
+			return err
+		}
+		fmt.Fprintf(cs.ioh.Stderr, "created directory %s\n", dir)
+	}
+	return nil
+}
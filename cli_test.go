@@ -2,21 +2,43 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"maps"
+	"path/filepath"
+	"reflect"
 	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"github.com/konyahin/sttemp/engine"
 )
 
 type MockCommandRunner struct {
 	ShouldFail   bool
 	CapturedName string
 	CapturedArgs []string
+	CapturedEnv  []string
+	// arguments of all runs
+	Calls [][]string
+	// printed to stdout by every run
+	Output string
 }
 
 func (m *MockCommandRunner) Run(ioh *IOHandler, name string, args ...string) error {
 	m.CapturedName = name
 	m.CapturedArgs = args
+	m.CapturedEnv = ioh.Env
+	m.Calls = append(m.Calls, append([]string{name}, args...))
+	if m.Output != "" {
+		fmt.Fprint(ioh.Stdout, m.Output)
+	}
 
 	if m.ShouldFail {
 		return errors.New("simulated error")
@@ -25,6 +47,29 @@ func (m *MockCommandRunner) Run(ioh *IOHandler, name string, args ...string) err
 	return nil
 }
 
+// memoryFS is a file system with files from the /templates directory, keys
+// are absolute paths, so the same map can keep generated files
+type memoryFS map[string]string
+
+func (m memoryFS) Open(name string) (fs.File, error) {
+	fsys := make(fstest.MapFS)
+	for path, content := range m {
+		if name, ok := strings.CutPrefix(path, "/templates/"); ok {
+			fsys[name] = &fstest.MapFile{Data: []byte(content)}
+		}
+	}
+	return fsys.Open(name)
+}
+
+func newStorage(t *testing.T, files map[string]string) *engine.Storage {
+	t.Helper()
+	storage, err := engine.NewStorage(memoryFS(files), "/templates")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return storage
+}
+
 func TestCliValidation(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -37,7 +82,7 @@ func TestCliValidation(t *testing.T) {
 				outputFileName: "output.txt",
 				defaultName:    true,
 				templateNames:  []string{},
-				storage:        &Storage{templates: map[string]TemplateFile{}},
+				storage:        newStorage(t, nil),
 			},
 			wantErr: "both -d and -o flags were set, but only one of them can be used at the same time",
 		},
@@ -46,7 +91,7 @@ func TestCliValidation(t *testing.T) {
 			clistate: CliState{
 				outputFileName: "",
 				templateNames:  []string{},
-				storage:        &Storage{templates: map[string]TemplateFile{}},
+				storage:        newStorage(t, nil),
 				editMode:       true,
 			},
 			wantErr: "edit mode was set, but no template name was provided",
@@ -56,36 +101,80 @@ func TestCliValidation(t *testing.T) {
 			clistate: CliState{
 				outputFileName: "",
 				templateNames:  []string{"template1", "template2"},
-				storage:        &Storage{templates: map[string]TemplateFile{}},
+				storage:        newStorage(t, nil),
 				editMode:       true,
 			},
 			wantErr: "edit mode was set, but too many template names were provided",
 		},
+		{
+			name: "edit mode with templates from archive",
+			clistate: CliState{
+				templateNames: []string{"template"},
+				storage:       newStorage(t, map[string]string{"/templates/template": ""}),
+				readOnly:      true,
+				editMode:      true,
+			},
+			wantErr: "edit mode was set, but templates from /templates can't be edited",
+		},
 		{
 			name: "non-existent template",
 			clistate: CliState{
 				outputFileName: "",
 				templateNames:  []string{"nonexistent"},
-				storage:        &Storage{templates: map[string]TemplateFile{}},
+				storage:        newStorage(t, nil),
 			},
 			wantErr: "template nonexistent not found",
 		},
+		{
+			name: "ambiguous template name",
+			clistate: CliState{
+				templateNames: []string{"mit"},
+				storage: newStorage(t, map[string]string{
+					"/templates/LICENSE/mit": "",
+					"/templates/docs/mit":    "",
+				}),
+			},
+			wantErr: "template mit is ambiguous, it can be: LICENSE/mit, docs/mit",
+		},
 		{
 			name: "template with no default name but -d flag set",
 			clistate: CliState{
 				outputFileName: "",
 				defaultName:    true,
 				templateNames:  []string{"template-without-default"},
-				storage: &Storage{templates: map[string]TemplateFile{
-					"template-without-default": {
-						Name:        "template-without-default",
-						DefaultName: "",
-						Path:        "/path/to/template",
-					},
-				}},
+				storage: newStorage(t, map[string]string{
+					"/templates/template-without-default": "",
+				}),
 			},
 			wantErr: "template template-without-default has no default name, but -d flag was set",
 		},
+		{
+			name: "update with template names",
+			clistate: CliState{
+				templateNames: []string{"template"},
+				storage:       newStorage(t, nil),
+				updateMode:    true,
+			},
+			wantErr: "--update renders files from .sttemp-answers.json and cannot be used with template names or other modes",
+		},
+		{
+			name: "inspect without template name",
+			clistate: CliState{
+				templateNames: []string{},
+				storage:       newStorage(t, nil),
+				command:       InspectCommand,
+			},
+			wantErr: "inspect command needs exactly one template name",
+		},
+		{
+			name: "json output for template rendering",
+			clistate: CliState{
+				templateNames: []string{"template"},
+				storage:       newStorage(t, nil),
+				jsonOutput:    true,
+			},
+			wantErr: "--json can be used only for listing templates or with commands",
+		},
 	}
 
 	for _, tt := range testCases {
@@ -121,20 +210,20 @@ func TestEditMode(t *testing.T) {
 			name:        "edit mode should use EDITOR environment variable",
 			editorVar:   "emacs",
 			expectedCmd: "emacs",
-			expectedArg: "/path/to/template/for-edit",
+			expectedArg: "/templates/for-edit",
 		},
 		{
 			name:        "edit mode should use vi, if EDITOR environment variable is missing",
 			editorVar:   "",
 			expectedCmd: "vi",
-			expectedArg: "/path/to/template/for-edit",
+			expectedArg: "/templates/for-edit",
 		},
 		{
 			name:        "edit mode should return errors, if something goes wrong",
 			editorVar:   "",
 			shouldFail:  true,
 			expectedCmd: "vi",
-			expectedArg: "/path/to/template/for-edit",
+			expectedArg: "/templates/for-edit",
 			expectError: true,
 		},
 	}
@@ -156,15 +245,9 @@ func TestEditMode(t *testing.T) {
 			}
 			cliState := CliState{
 				templateNames: []string{"for-edit"},
-				storage: &Storage{templates: map[string]TemplateFile{
-					"for-edit": {
-						Name:        "for-edit",
-						DefaultName: "",
-						Path:        "/path/to/template/for-edit",
-					},
-				}},
-				ioh:      ioh,
-				editMode: true,
+				storage:       newStorage(t, map[string]string{"/templates/for-edit": ""}),
+				ioh:           ioh,
+				editMode:      true,
 			}
 
 			err := cliState.Run()
@@ -196,70 +279,78 @@ func TestEditMode(t *testing.T) {
 }
 
 func TestListTemplates(t *testing.T) {
-	var writer bytes.Buffer
+	var writer, errWriter bytes.Buffer
 	ioh := &IOHandler{
 		Stdout: &writer,
+		Stderr: &errWriter,
 	}
 
 	testCases := []struct {
 		name          string
-		storage       map[string]TemplateFile
+		storage       map[string]string
 		expect        string
 		listTemplates bool
+		jsonOutput    bool
+		// errors of broken templates
+		expectErr string
 	}{
 		{
 			name: "happy path",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/path/to/template/first",
-				},
-				"second": {
-					Name:        "second",
-					DefaultName: "parent",
-					Path:        "/path/to/template/parent/second",
-				},
+			storage: map[string]string{
+				"/templates/first":         "",
+				"/templates/parent/second": "",
 			},
-			expect: "first\nsecond - parent\n",
+			expect: "first\nparent/second - parent\n",
 		},
 		{
 			name:    "empty storage",
-			storage: map[string]TemplateFile{},
+			storage: map[string]string{},
 			expect:  "",
 		},
 		{
 			name: "list templates - happy path",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/path/to/template/first",
-				},
-				"second": {
-					Name:        "second",
-					DefaultName: "parent",
-					Path:        "/path/to/template/parent/second",
-				},
+			storage: map[string]string{
+				"/templates/first":         "",
+				"/templates/parent/second": "",
 			},
-			expect:        "first\nsecond\n",
+			expect:        "first\nparent/second\n",
 			listTemplates: true,
 		},
 		{
 			name:          "list templates - empty storage",
-			storage:       map[string]TemplateFile{},
+			storage:       map[string]string{},
 			expect:        "",
 			listTemplates: true,
 		},
+		{
+			name: "broken template",
+			storage: map[string]string{
+				"/templates/broken":        "{a|b}",
+				"/templates/parent/second": "",
+			},
+			expect:    "parent/second - parent\n",
+			expectErr: "/templates/broken:1:1: unknown filter \"b\"\n",
+		},
+		{
+			name: "broken template as JSON",
+			storage: map[string]string{
+				"/templates/broken": "{a|b}",
+			},
+			expect:     "[]\n",
+			jsonOutput: true,
+			expectErr:  "/templates/broken:1:1: unknown filter \"b\"\n",
+		},
 	}
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			defer writer.Reset()
+			defer errWriter.Reset()
 			cliState := CliState{
-				storage:       &Storage{templates: tt.storage},
+				storage:       newStorage(t, tt.storage),
 				ioh:           ioh,
 				listTemplates: tt.listTemplates,
+				jsonOutput:    tt.jsonOutput,
 			}
 
 			err := cliState.Run()
@@ -272,6 +363,9 @@ func TestListTemplates(t *testing.T) {
 			if result != tt.expect {
 				t.Fatalf("wrong output format, expected:\n%v\nbut got:\n%v\n", tt.expect, result)
 			}
+			if errWriter.String() != tt.expectErr {
+				t.Fatalf("wrong errors, expected:\n%v\nbut got:\n%v\n", tt.expectErr, errWriter.String())
+			}
 		})
 	}
 }
@@ -283,10 +377,7 @@ func TestTemplateOutput(t *testing.T) {
 		LookupEnv: func(key string) (string, bool) {
 			return key, true
 		},
-		ReadFile: func(name string) ([]byte, error) {
-			return []byte(name + ": {VAR}\n"), nil
-		},
-		Create: func(name string) (OutputFile, error) {
+		Create: func(name string, perm fs.FileMode) (OutputFile, error) {
 			writer.Write([]byte(name))
 			writer.Write([]byte("\n\n"))
 			return StdoutInstance(&writer), nil
@@ -295,115 +386,84 @@ func TestTemplateOutput(t *testing.T) {
 
 	testCases := []struct {
 		name           string
-		storage        map[string]TemplateFile
+		storage        map[string]string
 		outputFileName string
 		defaultName    bool
 		expect         string
 	}{
 		{
 			name: "happy path",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/path/to/template/first",
-				},
+			storage: map[string]string{
+				"/templates/first": "first: {VAR}\n",
 			},
-			expect: "/path/to/template/first: VAR\n",
+			expect: "first: VAR\n",
 		},
 		{
 			name: "template with default name but -d not set",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "default",
-					Path:        "/path/to/template/first",
-				},
+			storage: map[string]string{
+				"/templates/default/first": "first: {VAR}\n",
 			},
-			expect: "/path/to/template/first: VAR\n",
+			expect: "first: VAR\n",
 		},
 		{
 			name: "output into file",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/path/to/template/first",
-				},
+			storage: map[string]string{
+				"/templates/first": "first: {VAR}\n",
 			},
 			outputFileName: "second",
-			expect:         "second\n\n/path/to/template/first: VAR\n",
+			expect:         "second\n\nfirst: VAR\n",
 		},
 		{
 			name: "output into file template with default name but -d not set",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "default",
-					Path:        "/path/to/template/first",
-				},
+			storage: map[string]string{
+				"/templates/default/first": "first: {VAR}\n",
 			},
 			outputFileName: "second",
-			expect:         "second\n\n/path/to/template/first: VAR\n",
+			expect:         "second\n\nfirst: VAR\n",
 		},
 		{
 			name: "output into file with default name",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "default",
-					Path:        "/path/to/template/first",
-				},
+			storage: map[string]string{
+				"/templates/default/first": "first: {VAR}\n",
 			},
 			defaultName: true,
-			expect:      "default\n\n/path/to/template/first: VAR\n",
+			expect:      "default\n\nfirst: VAR\n",
 		},
 		{
 			name: "a few templates",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "default",
-					Path:        "/path/to/template/first",
-				},
-				"second": {
-					Name:        "second",
-					DefaultName: "",
-					Path:        "/path/to/template/second",
-				},
+			storage: map[string]string{
+				"/templates/default/first": "first: {VAR}\n",
+				"/templates/second":        "second: {VAR}\n",
 			},
-			expect: "/path/to/template/first: VAR\n/path/to/template/second: VAR\n",
+			expect: "first: VAR\nsecond: VAR\n",
 		},
 		{
 			name: "a few templates with output into file",
-			storage: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "default",
-					Path:        "/path/to/template/first",
-				},
-				"second": {
-					Name:        "second",
-					DefaultName: "",
-					Path:        "/path/to/template/second",
-				},
+			storage: map[string]string{
+				"/templates/default/first": "first: {VAR}\n",
+				"/templates/second":        "second: {VAR}\n",
 			},
 			outputFileName: "output",
-			expect:         "output\n\n/path/to/template/first: VAR\noutput\n\n/path/to/template/second: VAR\n",
+			expect:         "output\n\nfirst: VAR\noutput\n\nsecond: VAR\n",
 		},
 	}
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			defer writer.Reset()
-			names := slices.Collect(maps.Keys(tt.storage))
-			slices.Sort(names)
+			storage := newStorage(t, tt.storage)
+			var names []string
+			for _, templateFile := range storage.Templates() {
+				names = append(names, templateFile.Name)
+			}
 			cliState := CliState{
 				templateNames:  names,
-				storage:        &Storage{templates: tt.storage},
+				storage:        storage,
 				ioh:            ioh,
 				outputFileName: tt.outputFileName,
 				defaultName:    tt.defaultName,
+				// answers file is tested in TestRecordAndUpdate
+				noRecord: true,
 			}
 
 			err := cliState.Run()
@@ -419,3 +479,1176 @@ func TestTemplateOutput(t *testing.T) {
 		})
 	}
 }
+
+type MemoryFile struct {
+	bytes.Buffer
+	name  string
+	files map[string]string
+}
+
+func (m *MemoryFile) Close() error {
+	m.files[m.name] = m.String()
+	return nil
+}
+
+func memoryIOHandler(files map[string]string, stdout *bytes.Buffer) *IOHandler {
+	return &IOHandler{
+		Stdout: stdout,
+		Stderr: stdout,
+		LookupEnv: func(key string) (string, bool) {
+			return "", false
+		},
+		ReadFile: func(name string) ([]byte, error) {
+			content, ok := files[name]
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+			return []byte(content), nil
+		},
+		Create: func(name string, perm fs.FileMode) (OutputFile, error) {
+			return &MemoryFile{name: name, files: files}, nil
+		},
+	}
+}
+
+func TestRecordAndUpdate(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/LICENSE/mit": "Copyright {YEAR} {NAME}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	storage := newStorage(t, files)
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return map[string]string{"YEAR": "2024", "NAME": "Alice"}[key], true
+	}
+
+	// output into stdout and --no-record don't write the answers file
+	for _, noRecord := range []bool{false, true} {
+		cliState := CliState{
+			defaultName:   noRecord,
+			templateNames: []string{"mit"},
+			storage:       storage,
+			ioh:           ioh,
+			noInput:       true,
+			noRecord:      noRecord,
+		}
+		if err := cliState.Run(); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if _, ok := files[AnswersFileName]; ok {
+			t.Fatalf("answers file should not be created")
+		}
+	}
+	stdout.Reset()
+	delete(files, "LICENSE")
+
+	cliState := CliState{
+		defaultName:   true,
+		templateNames: []string{"mit"},
+		storage:       storage,
+		ioh:           ioh,
+		noInput:       true,
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if files["LICENSE"] != "Copyright 2024 Alice\n" {
+		t.Fatalf("wrong generated file: %q", files["LICENSE"])
+	}
+	if _, ok := files[AnswersFileName]; !ok {
+		t.Fatalf("answers file was not created")
+	}
+
+	// nothing should be changed, when template is the same
+	updateState := CliState{
+		storage:    storage,
+		ioh:        memoryIOHandler(files, &stdout),
+		noInput:    true,
+		updateMode: true,
+	}
+	if err := updateState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if stdout.String() != "LICENSE is up to date\n" {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+	stdout.Reset()
+
+	// recorded values should be used for the changed template
+	files["/templates/LICENSE/mit"] = "MIT License\n\nCopyright {YEAR} {NAME}\n"
+	if err := updateState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if files["LICENSE"] != "MIT License\n\nCopyright 2024 Alice\n" {
+		t.Fatalf("wrong updated file: %q", files["LICENSE"])
+	}
+	expectDiff := "--- a/LICENSE\n+++ b/LICENSE\n@@ -1 +1,3 @@\n+MIT License\n+\n Copyright 2024 Alice\n"
+	if stdout.String() != expectDiff {
+		t.Fatalf("wrong diff, expected:\n%v\nbut got:\n%v\n", expectDiff, stdout.String())
+	}
+
+	answers, err := loadAnswers(ioh)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	hash := sha256.Sum256([]byte(files["/templates/LICENSE/mit"]))
+	if answers.Templates[0].Hash != hex.EncodeToString(hash[:]) {
+		t.Fatalf("hash of the template was not updated")
+	}
+
+	// local changes are kept without --force
+	files["LICENSE"] += "Local changes\n"
+	files["/templates/LICENSE/mit"] = "MIT License\n\nCopyright (c) {YEAR} {NAME}\n"
+	stdout.Reset()
+	if err := updateState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if files["LICENSE"] != "MIT License\n\nCopyright 2024 Alice\nLocal changes\n" {
+		t.Fatalf("changed file was overwritten: %q", files["LICENSE"])
+	}
+	if stdout.String() != "LICENSE was changed after generation, it is skipped, use --force to overwrite it\n" {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+
+	updateState.force = true
+	if err := updateState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if files["LICENSE"] != "MIT License\n\nCopyright (c) 2024 Alice\n" {
+		t.Fatalf("wrong updated file: %q", files["LICENSE"])
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/LICENSE/mit": "--- sttemp\ndescription: MIT license\n[NAME]\ndescription: copyright holder\n---\nCopyright {YEAR} {NAME}\n",
+	}
+	storage := newStorage(t, files)
+
+	jsonInfo := `{
+  "name": "LICENSE/mit",
+  "default_name": "LICENSE",
+  "path": "/templates/LICENSE/mit",
+  "dir": "/templates",
+  "description": "MIT license",
+  "variables": [
+    {
+      "name": "YEAR",
+      "description": "",
+      "default": ""
+    },
+    {
+      "name": "NAME",
+      "description": "copyright holder",
+      "default": ""
+    }
+  ]
+}`
+
+	testCases := []struct {
+		name          string
+		command       string
+		templateNames []string
+		listTemplates bool
+		jsonOutput    bool
+		expect        string
+	}{
+		{
+			name:          "inspect as text",
+			command:       InspectCommand,
+			templateNames: []string{"mit"},
+			expect: "name: LICENSE/mit\ndefault name: LICENSE\npath: /templates/LICENSE/mit\n" +
+				"description: MIT license\nvariables:\n  YEAR\n  NAME - copyright holder\n",
+		},
+		{
+			name:          "inspect as json",
+			command:       InspectCommand,
+			templateNames: []string{"mit"},
+			jsonOutput:    true,
+			expect:        jsonInfo + "\n",
+		},
+		{
+			name:          "list as json",
+			listTemplates: true,
+			jsonOutput:    true,
+			expect:        "[\n  " + strings.ReplaceAll(jsonInfo, "\n", "\n  ") + "\n]\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer stdout.Reset()
+			cliState := CliState{
+				command:       tt.command,
+				templateNames: tt.templateNames,
+				storage:       storage,
+				ioh:           memoryIOHandler(files, &stdout),
+				listTemplates: tt.listTemplates,
+				jsonOutput:    tt.jsonOutput,
+			}
+
+			if err := cliState.Run(); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if stdout.String() != tt.expect {
+				t.Fatalf("wrong output, expected:\n%v\nbut got:\n%v\n", tt.expect, stdout.String())
+			}
+		})
+	}
+}
+
+func TestInspectPack(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{}
+	storage := newStorage(t, files)
+	pack := fstest.MapFS{
+		"go/mod": {Data: []byte("--- sttemp\noutput: go.mod\n---\nmodule {MODULE}\n")},
+	}
+	if err := storage.Mount("company", pack, "/packs/company"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	cliState := CliState{
+		command:       InspectCommand,
+		templateNames: []string{"company/mod"},
+		storage:       storage,
+		ioh:           memoryIOHandler(files, &stdout),
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	expect := "name: company/go/mod\npack: company\ndefault name: go.mod\npath: /packs/company/go/mod\nvariables:\n  MODULE\n"
+	if stdout.String() != expect {
+		t.Fatalf("wrong output, expected:\n%v\nbut got:\n%v\n", expect, stdout.String())
+	}
+
+	stdout.Reset()
+	cliState.jsonOutput = true
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	var info TemplateInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if info.Namespace != "company" || info.Dir != "/packs/company" {
+		t.Fatalf("template should be from pack company in /packs/company, but got %q in %q", info.Namespace, info.Dir)
+	}
+}
+
+func TestVars(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/LICENSE/mit": "--- sttemp\nvalues-command: echo EMAIL=$(git config user.email)\n[NAME]\ndescription: copyright holder\n[YEAR]\ndefault: 2025\n[HOLDER]\nvalue: {NAME | upper}\n[SPDX]\nif: OPEN\n---\nCopyright {YEAR}-{@YEAR} {HOLDER} {EMAIL} {SPDX}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return "Alice", key == "NAME"
+	}
+	ioh.CommandRunner = &MockCommandRunner{Output: "EMAIL=alice@example.com\n"}
+	cliState := CliState{
+		command:       VarsCommand,
+		templateNames: []string{"mit"},
+		storage:       newStorage(t, files),
+		ioh:           ioh,
+	}
+
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expect := "VARIABLE  STATUS           DEFAULT  DESCRIPTION\n" +
+		"YEAR      default          2025     \n" +
+		"@YEAR     builtin                   \n" +
+		"HOLDER    derived                   \n" +
+		"NAME      env                       copyright holder\n" +
+		"EMAIL     computed                  \n" +
+		"OPEN      missing                   \n" +
+		"SPDX      missing if OPEN           \n"
+	if stdout.String() != expect {
+		t.Fatalf("wrong output, expected:\n%q\nbut got:\n%q\n", expect, stdout.String())
+	}
+}
+
+func TestVarsSecrets(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/env/dotenv": "--- sttemp\n[TOKEN]\nsecret-command: pass show github/token\n[KEY]\nsecret-file: ~/.keys/api\n" +
+			"[PASSWORD]\nsecret: yes\ndefault: hunter2\n---\nTOKEN={TOKEN}\nKEY={KEY}\nPASSWORD={PASSWORD}\n",
+	}
+	runner := &MockCommandRunner{}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.CommandRunner = runner
+	cliState := CliState{
+		command:       VarsCommand,
+		templateNames: []string{"dotenv"},
+		storage:       newStorage(t, files),
+		ioh:           ioh,
+	}
+
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expect := "VARIABLE  STATUS   DEFAULT   DESCRIPTION\n" +
+		"TOKEN     secret             \n" +
+		"KEY       secret             \n" +
+		"PASSWORD  default  ********  \n"
+	if stdout.String() != expect {
+		t.Fatalf("wrong output, expected:\n%q\nbut got:\n%q\n", expect, stdout.String())
+	}
+
+	// defaults of secrets are not shown by inspect too
+	stdout.Reset()
+	cliState.command = InspectCommand
+	cliState.jsonOutput = true
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if strings.Contains(stdout.String(), "hunter2") {
+		t.Fatalf("default of secret is printed: %s", stdout.String())
+	}
+	stdout.Reset()
+	cliState.jsonOutput = false
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "  PASSWORD [********] (secret)\n") {
+		t.Fatalf("default of secret is not masked: %s", stdout.String())
+	}
+	// secrets are not read to show statuses
+	if len(runner.Calls) != 0 {
+		t.Fatalf("expected no commands, but got %q", runner.Calls)
+	}
+}
+
+func TestMissingVariables(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/first":  "{A} {B} {C}\n",
+		"/templates/second": "--- sttemp\n[D]\ndefault: d\n---\n{B} {D} {E}\n",
+		"/templates/third":  "{B}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return key, key == "B"
+	}
+	cliState := CliState{
+		templateNames:  []string{"first", "second", "third"},
+		storage:        newStorage(t, files),
+		ioh:            ioh,
+		noInput:        true,
+		outputFileName: "output",
+	}
+
+	err := cliState.Run()
+
+	if !errors.Is(err, engine.ErrMissingVariable) {
+		t.Fatalf("expected ErrMissingVariable, but got: %v", err)
+	}
+
+	expect := "variables are not set and --no-input is enabled; set them in environment:\n" +
+		"  /templates/first:1:1: A\n" +
+		"  /templates/first:1:9: C\n" +
+		"  /templates/second:5:9: E"
+	if err.Error() != expect {
+		t.Fatalf("expected error:\n%v\nbut got:\n%v", expect, err)
+	}
+
+	if _, ok := files["output"]; ok {
+		t.Fatalf("nothing should be written, when variables are missing")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/first": "Hello, {NAME\n",
+	}
+	cliState := CliState{
+		templateNames: []string{"first"},
+		storage:       newStorage(t, files),
+		ioh:           memoryIOHandler(files, &stdout),
+		strict:        true,
+	}
+
+	err := cliState.Run()
+
+	expect := "found 1 issues in templates:\n/templates/first:1:8: placeholder \"{NAME\" has no closing delimiter"
+	if err == nil || err.Error() != expect {
+		t.Fatalf("expected error:\n%v\nbut got:\n%v", expect, err)
+	}
+
+	if stdout.String() != "" {
+		t.Fatalf("nothing should be rendered, but got: %q", stdout.String())
+	}
+}
+
+func TestOutputDirectories(t *testing.T) {
+	testCases := []struct {
+		name    string
+		existed []string
+		noMkdir bool
+		dirMode fs.FileMode
+		created []string
+		modes   []fs.FileMode
+	}{
+		{
+			name:    "create all missing directories",
+			created: []string{".github", ".github/workflows"},
+			modes:   []fs.FileMode{DefaultDirMode, DefaultDirMode},
+		},
+		{
+			name:    "create only missing directories",
+			existed: []string{".github"},
+			dirMode: 0o700,
+			created: []string{".github/workflows"},
+			modes:   []fs.FileMode{0o700},
+		},
+		{
+			name:    "don't create directories with --no-mkdir",
+			noMkdir: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			files := map[string]string{
+				"/templates/ci/github": "--- sttemp\noutput: .github/workflows/ci.yml\n---\non: push\n",
+			}
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.Stat = func(name string) (fs.FileInfo, error) {
+				if slices.Contains(tt.existed, name) {
+					return nil, nil
+				}
+				return nil, fs.ErrNotExist
+			}
+			var created []string
+			var modes []fs.FileMode
+			ioh.Mkdir = func(name string, perm fs.FileMode) error {
+				created = append(created, name)
+				modes = append(modes, perm)
+				return nil
+			}
+			cliState := CliState{
+				defaultName:   true,
+				templateNames: []string{"github"},
+				storage:       newStorage(t, files),
+				ioh:           ioh,
+				noMkdir:       tt.noMkdir,
+				dirMode:       tt.dirMode,
+			}
+
+			if err := cliState.Run(); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if files[".github/workflows/ci.yml"] != "on: push\n" {
+				t.Fatalf("wrong generated file: %q", files[".github/workflows/ci.yml"])
+			}
+			if !slices.Equal(created, tt.created) || !slices.Equal(modes, tt.modes) {
+				t.Fatalf("expected %v created with %v, but got %v with %v", tt.created, tt.modes, created, modes)
+			}
+
+			var report strings.Builder
+			for _, dir := range tt.created {
+				fmt.Fprintf(&report, "created directory %s\n", dir)
+			}
+			if stdout.String() != report.String() {
+				t.Fatalf("wrong report, expected:\n%v\nbut got:\n%v", report.String(), stdout.String())
+			}
+		})
+	}
+}
+
+func TestTemplatedOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/post": "# {TITLE}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.Stat = func(name string) (fs.FileInfo, error) {
+		return nil, nil
+	}
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return map[string]string{"TITLE": "Hello World", "DATE": "2025-01-02"}[key], true
+	}
+	cliState := CliState{
+		outputFileName: "posts/{DATE}-{TITLE | kebab}.md",
+		templateNames:  []string{"post"},
+		storage:        newStorage(t, files),
+		ioh:            ioh,
+		noInput:        true,
+	}
+
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if files["posts/2025-01-02-hello-world.md"] != "# Hello World\n" {
+		t.Fatalf("wrong generated files: %v", files)
+	}
+
+	answers, err := loadAnswers(ioh)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	answer := answers.Templates[0]
+	if answer.Output != "posts/2025-01-02-hello-world.md" || answer.Values["DATE"] != "2025-01-02" {
+		t.Fatalf("wrong answer: %#v", answer)
+	}
+
+	// variables, which are used only in the path, are located in -o
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return "Hello World", key == "TITLE"
+	}
+	expect := "variables are not set and --no-input is enabled; set them in environment:\n" +
+		"  -o posts/{DATE}-{TITLE | kebab}.md: DATE"
+	if err := cliState.Run(); err == nil || err.Error() != expect {
+		t.Fatalf("expected error:\n%v\nbut got:\n%v", expect, err)
+	}
+}
+
+func TestOutputFileMode(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{}
+	ioh := memoryIOHandler(files, &stdout)
+	// generated files exist already
+	existing := fstest.MapFS{
+		"script": {Mode: 0o644},
+		"README": {Mode: 0o644},
+		".env":   {Mode: 0o644},
+	}
+	ioh.Stat = func(name string) (fs.FileInfo, error) {
+		return fs.Stat(existing, name)
+	}
+	modes := make(map[string]fs.FileMode)
+	ioh.Create = func(name string, perm fs.FileMode) (OutputFile, error) {
+		modes[name] = perm
+		return &MemoryFile{name: name, files: files}, nil
+	}
+	changedModes := make(map[string]fs.FileMode)
+	ioh.Chmod = func(name string, mode fs.FileMode) error {
+		changedModes[name] = mode
+		return nil
+	}
+
+	templates := fstest.MapFS{
+		"script/build": {Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+		"README/md":    {Data: []byte("# readme\n"), Mode: 0o644},
+		"env/dotenv":   {Data: []byte("--- sttemp\noutput: .env\nmode: 600\n---\nTOKEN=\n")},
+	}
+	storage, err := engine.NewStorage(templates, "/templates")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	cliState := CliState{
+		defaultName:   true,
+		templateNames: []string{"build", "README/md", "dotenv"},
+		storage:       storage,
+		ioh:           ioh,
+		noRecord:      true,
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expect := map[string]fs.FileMode{"script": 0o777, "README": 0o666, ".env": 0o600}
+	if !maps.Equal(modes, expect) {
+		t.Fatalf("expected modes %v, but got %v", expect, modes)
+	}
+	// modes of existing files are changed only for executable templates
+	// and declared modes
+	expect = map[string]fs.FileMode{"script": 0o755, ".env": 0o600}
+	if !maps.Equal(changedModes, expect) {
+		t.Fatalf("expected changed modes %v, but got %v", expect, changedModes)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	files := map[string]string{
+		"/templates/go/mod": "--- sttemp\noutput: go.mod\nhook: go mod tidy\nhook: git init\n---\nmodule {MODULE}\n",
+	}
+	pack := fstest.MapFS{
+		"sh/script": {Data: []byte("--- sttemp\nhook: chmod +x \"$OUTPUT\"\n---\necho\n")},
+	}
+
+	testCases := []struct {
+		name          string
+		templateNames []string
+		defaultName   bool
+		noHooks       bool
+		noInput       bool
+		input         string
+		expect        [][]string
+		// environment of hooks
+		env []string
+	}{
+		{
+			name:          "hooks are run in order",
+			templateNames: []string{"mod"},
+			defaultName:   true,
+			expect:        [][]string{{"sh", "-c", "go mod tidy"}, {"sh", "-c", "git init"}},
+			env:           []string{"STTEMP_OUTPUT=go.mod", "STTEMP_MODULE=example.com/app"},
+		},
+		{
+			name:          "no hooks for stdout",
+			templateNames: []string{"mod"},
+		},
+		{
+			name:          "--no-hooks",
+			templateNames: []string{"mod"},
+			defaultName:   true,
+			noHooks:       true,
+		},
+		{
+			name:          "confirmed hooks from pack",
+			templateNames: []string{"company/script"},
+			defaultName:   true,
+			input:         "y\n",
+			expect:        [][]string{{"sh", "-c", "chmod +x \"$OUTPUT\""}},
+			env:           []string{"STTEMP_OUTPUT=sh"},
+		},
+		{
+			name:          "declined hooks from pack",
+			templateNames: []string{"company/script"},
+			defaultName:   true,
+			input:         "\n",
+		},
+		{
+			name:          "hooks from pack with --no-input",
+			templateNames: []string{"company/script"},
+			defaultName:   true,
+			noInput:       true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			runner := &MockCommandRunner{}
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.Stdin = strings.NewReader(tt.input)
+			ioh.Stat = func(name string) (fs.FileInfo, error) {
+				return nil, nil
+			}
+			ioh.LookupEnv = func(key string) (string, bool) {
+				return "example.com/app", key == "MODULE"
+			}
+			ioh.CommandRunner = runner
+
+			storage := newStorage(t, files)
+			if err := storage.Mount("company", pack, "/packs/company"); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			cliState := CliState{
+				defaultName:   tt.defaultName,
+				templateNames: tt.templateNames,
+				storage:       storage,
+				ioh:           ioh,
+				noHooks:       tt.noHooks,
+				noInput:       tt.noInput,
+			}
+			if err := cliState.Run(); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if !reflect.DeepEqual(runner.Calls, tt.expect) {
+				t.Fatalf("expected commands %q, but got %q", tt.expect, runner.Calls)
+			}
+			if !slices.Equal(runner.CapturedEnv, tt.env) {
+				t.Fatalf("expected environment %q, but got %q", tt.env, runner.CapturedEnv)
+			}
+		})
+	}
+}
+
+func TestHookPlaceholders(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/api": "--- sttemp\nhook: ls {OUTPUT} {PATH | upper} ${HOME}\n---\nGET {PATH}\n",
+	}
+	runner := &MockCommandRunner{}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.Stdin = strings.NewReader("/api's\n")
+	ioh.Stat = func(name string) (fs.FileInfo, error) {
+		return nil, nil
+	}
+	ioh.LookupEnv = func(key string) (string, bool) {
+		value, ok := map[string]string{"PATH": "/bin", "STTEMP_OUTPUT": "old"}[key]
+		return value, ok
+	}
+	ioh.CommandRunner = runner
+
+	cliState := CliState{
+		outputFileName: "routes/api.txt",
+		templateNames:  []string{"api"},
+		storage:        newStorage(t, files),
+		ioh:            ioh,
+		noEnv:          true,
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expect := [][]string{{"sh", "-c", `ls 'routes/api.txt' '/API'\''S' ${HOME}`}}
+	if !reflect.DeepEqual(runner.Calls, expect) {
+		t.Fatalf("expected commands %q, but got %q", expect, runner.Calls)
+	}
+	// existing variables are not replaced
+	env := []string{"STTEMP_PATH=/api's"}
+	if !slices.Equal(runner.CapturedEnv, env) {
+		t.Fatalf("expected environment %q, but got %q", env, runner.CapturedEnv)
+	}
+}
+
+func TestFailedHook(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/go/mod": "--- sttemp\nhook: go mod tidy\n---\nmodule {MODULE}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.Stat = func(name string) (fs.FileInfo, error) {
+		return nil, nil
+	}
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return "example.com/app", true
+	}
+	ioh.CommandRunner = &MockCommandRunner{ShouldFail: true}
+
+	cliState := CliState{
+		defaultName:   true,
+		templateNames: []string{"mod"},
+		storage:       newStorage(t, files),
+		ioh:           ioh,
+	}
+	err := cliState.Run()
+	if err == nil || err.Error() != "hook \"go mod tidy\" of go/mod: simulated error" {
+		t.Fatalf("expected error of the hook, but got: %v", err)
+	}
+
+	// file is generated and recorded before hooks
+	if files["go"] != "module example.com/app\n" {
+		t.Fatalf("wrong generated file: %q", files["go"])
+	}
+	if _, ok := files[AnswersFileName]; !ok {
+		t.Fatalf("answers file was not created")
+	}
+}
+
+func TestValuesCommand(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/adr": "--- sttemp\nvalues-command: echo NUMBER=$(ls docs/adr | wc -l)\n---\n# {NUMBER}. {TITLE}\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	runner := &MockCommandRunner{Output: "NUMBER=7\nTITLE=from command\n"}
+	ioh.CommandRunner = runner
+
+	// environment overrides computed values
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return "Use Go", key == "TITLE"
+	}
+
+	// --no-hooks skips only hooks after generation
+	cliState := CliState{
+		templateNames: []string{"adr"},
+		storage:       newStorage(t, files),
+		ioh:           ioh,
+		noInput:       true,
+		noHooks:       true,
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if stdout.String() != "# 7. Use Go\n" {
+		t.Fatalf("wrong output: %q", stdout.String())
+	}
+	expect := [][]string{{"sh", "-c", "echo NUMBER=$(ls docs/adr | wc -l)"}}
+	if !reflect.DeepEqual(runner.Calls, expect) {
+		t.Fatalf("expected commands %q, but got %q", expect, runner.Calls)
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allowExec bool
+		expect    string
+		wantErr   string
+	}{
+		{
+			name:      "allowed commands",
+			allowExec: true,
+			expect:    "version v1.2.0 of app\n",
+		},
+		{
+			name:    "commands without --allow-exec",
+			wantErr: "/templates/version:1:9: can't get value for !git describe --tags: commands in templates are run only with --allow-exec",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"/templates/version": "version {!git describe --tags} of {NAME}\n",
+			}
+			var stdout bytes.Buffer
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.LookupEnv = func(key string) (string, bool) {
+				return "app", key == "NAME"
+			}
+			runner := &MockCommandRunner{Output: "v1.2.0\n"}
+			ioh.CommandRunner = runner
+
+			cliState := CliState{
+				outputFileName: "VERSION",
+				templateNames:  []string{"version"},
+				storage:        newStorage(t, files),
+				ioh:            ioh,
+				noInput:        true,
+				allowExec:      tt.allowExec,
+			}
+			err := cliState.Run()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, but got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if files["VERSION"] != tt.expect {
+				t.Fatalf("wrong generated file: %q", files["VERSION"])
+			}
+			if !slices.Equal(runner.CapturedArgs, []string{"-c", "git describe --tags"}) {
+				t.Fatalf("wrong command: %q", runner.CapturedArgs)
+			}
+
+			// commands are run again on update, so their output is not
+			// recorded
+			answers, err := loadAnswers(ioh)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !maps.Equal(answers.Templates[0].Values, map[string]string{"NAME": "app"}) {
+				t.Fatalf("wrong recorded values: %v", answers.Templates[0].Values)
+			}
+		})
+	}
+}
+
+func TestPackCommandPlaceholders(t *testing.T) {
+	files := map[string]string{}
+	pack := fstest.MapFS{
+		"version": {Data: []byte("version {!git describe --tags}\n")},
+	}
+
+	testCases := []struct {
+		name    string
+		input   string
+		noInput bool
+		wantErr string
+	}{
+		{
+			name:  "confirmed commands",
+			input: "y\n",
+		},
+		{
+			name:    "declined commands",
+			input:   "\n",
+			wantErr: "can't get value for !git describe --tags: commands of templates from pack company are run only after confirmation",
+		},
+		{
+			name:    "commands with --no-input",
+			noInput: true,
+			wantErr: "can't get value for !git describe --tags: commands of templates from pack company are run only after confirmation",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.Stdin = strings.NewReader(tt.input)
+			runner := &MockCommandRunner{Output: "v1.2.0\n"}
+			ioh.CommandRunner = runner
+
+			storage := newStorage(t, files)
+			if err := storage.Mount("company", pack, "/packs/company"); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			cliState := CliState{
+				templateNames: []string{"company/version"},
+				storage:       storage,
+				ioh:           ioh,
+				noInput:       tt.noInput,
+				allowExec:     true,
+			}
+			err := cliState.Run()
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, but got: %v", tt.wantErr, err)
+				}
+				if len(runner.Calls) != 0 {
+					t.Fatalf("expected no commands, but got %q", runner.Calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !strings.HasSuffix(stdout.String(), "Run them? [y/N]: version v1.2.0\n") {
+				t.Fatalf("wrong output: %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestPromptOrder(t *testing.T) {
+	template := "--- sttemp\n" +
+		"order: NAME\n" +
+		"[DOCKER]\ngroup: Container\n" +
+		"[REGISTRY]\ngroup: Container\nif: DOCKER\n" +
+		"---\n" +
+		"{REGISTRY} {AUTHOR} {NAME} {DOCKER} {LICENSE}\n"
+
+	testCases := []struct {
+		name    string
+		input   string
+		prompts string
+		expect  string
+	}{
+		{
+			name:  "condition is met",
+			input: "app\nyes\nghcr.io\nAlice\nMIT\n",
+			prompts: "Enter value for NAME: Container:\nEnter value for DOCKER: Enter value for REGISTRY: " +
+				"Enter value for AUTHOR: Enter value for LICENSE: ",
+			expect: "ghcr.io Alice app yes MIT\n",
+		},
+		{
+			name:  "condition is not met",
+			input: "app\nno\nAlice\nMIT\n",
+			prompts: "Enter value for NAME: Container:\nEnter value for DOCKER: " +
+				"Enter value for AUTHOR: Enter value for LICENSE: ",
+			expect: " Alice app no MIT\n",
+		},
+		{
+			name:  "short answer",
+			input: "app\ny\nghcr.io\nAlice\nMIT\n",
+			prompts: "Enter value for NAME: Container:\nEnter value for DOCKER: Enter value for REGISTRY: " +
+				"Enter value for AUTHOR: Enter value for LICENSE: ",
+			expect: "ghcr.io Alice app y MIT\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			files := map[string]string{"/templates/project": template}
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.Stderr = &stderr
+			// every prompt reads stdin with its own buffer
+			ioh.Stdin = iotest.OneByteReader(strings.NewReader(tt.input))
+
+			cliState := CliState{
+				templateNames: []string{"project"},
+				storage:       newStorage(t, files),
+				ioh:           ioh,
+			}
+			if err := cliState.Run(); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if stderr.String() != tt.prompts {
+				t.Fatalf("wrong prompts, expected:\n%q\nbut got:\n%q", tt.prompts, stderr.String())
+			}
+			if stdout.String() != tt.expect {
+				t.Fatalf("wrong output: %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	files := map[string]string{
+		"/templates/greeting": "--- sttemp\n[user]\ndefault: nobody\n---\nHello, {user} {first name}!\n",
+	}
+	env := map[string]string{
+		"USER":              "root",
+		"FIRST_NAME":        "Alice",
+		"STTEMP_USER":       "alice",
+		"STTEMP_FIRST_NAME": "Alice Smith",
+	}
+
+	testCases := []struct {
+		name      string
+		envPrefix string
+		noEnv     bool
+		expect    string
+		wantErr   string
+	}{
+		{
+			name:   "normalized names",
+			expect: "Hello, root Alice!\n",
+		},
+		{
+			name:      "prefix",
+			envPrefix: "STTEMP_",
+			expect:    "Hello, alice Alice Smith!\n",
+		},
+		{
+			name:    "environment is disabled",
+			noEnv:   true,
+			wantErr: "variables are not set and --no-input is enabled:\n  /templates/greeting:5:15: first name",
+		},
+		{
+			name:      "missing variable with prefix",
+			envPrefix: "APP_",
+			wantErr:   "variables are not set and --no-input is enabled; set them in environment:\n  /templates/greeting:5:15: first name (APP_FIRST_NAME)",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			ioh := memoryIOHandler(files, &stdout)
+			ioh.LookupEnv = func(key string) (string, bool) {
+				value, ok := env[key]
+				return value, ok
+			}
+
+			cliState := CliState{
+				templateNames: []string{"greeting"},
+				storage:       newStorage(t, files),
+				ioh:           ioh,
+				noInput:       true,
+				envPrefix:     tt.envPrefix,
+				noEnv:         tt.noEnv,
+			}
+			err := cliState.Run()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error:\n%v\nbut got:\n%v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if stdout.String() != tt.expect {
+				t.Fatalf("wrong output: %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestSecretVariables(t *testing.T) {
+	var stdout bytes.Buffer
+	files := map[string]string{
+		"/templates/env/dotenv": "--- sttemp\noutput: .env\n[TOKEN]\nsecret-command: pass show github/token\n" +
+			"[AUTH]\nvalue: Bearer {TOKEN}\n[KEY]\nsecret-file: ~/.keys/api\n[PASSWORD]\nsecret: yes\n---\n" +
+			"USER={USER}\nAUTH={AUTH}\nTOKEN={TOKEN}\nKEY={KEY}\nPASSWORD={PASSWORD}\n",
+		"/home/alice/.keys/api": "k3y\n",
+	}
+	ioh := memoryIOHandler(files, &stdout)
+	ioh.UserHomeDir = func() (string, error) {
+		return "/home/alice", nil
+	}
+	ioh.LookupEnv = func(key string) (string, bool) {
+		value, ok := map[string]string{"USER": "alice", "PASSWORD": "pa55"}[key]
+		return value, ok
+	}
+	runner := &MockCommandRunner{Output: "t0ken\n"}
+	ioh.CommandRunner = runner
+	storage := newStorage(t, files)
+
+	cliState := CliState{
+		defaultName:   true,
+		templateNames: []string{"dotenv"},
+		storage:       storage,
+		ioh:           ioh,
+		noInput:       true,
+	}
+	if err := cliState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if files[".env"] != "USER=alice\nAUTH=Bearer t0ken\nTOKEN=t0ken\nKEY=k3y\nPASSWORD=pa55\n" {
+		t.Fatalf("wrong generated file: %q", files[".env"])
+	}
+	expect := [][]string{{"sh", "-c", "pass show github/token"}}
+	if !reflect.DeepEqual(runner.Calls, expect) {
+		t.Fatalf("expected commands %q, but got %q", expect, runner.Calls)
+	}
+
+	answers, err := loadAnswers(ioh)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if values := answers.Templates[0].Values; !reflect.DeepEqual(values, map[string]string{"USER": "alice"}) {
+		t.Fatalf("secrets and derived values should not be recorded, but got: %v", values)
+	}
+
+	// secrets are read again, but they are not shown in the diff
+	files["/templates/env/dotenv"] = strings.Replace(files["/templates/env/dotenv"], "USER", "# generated\nUSER", 1)
+	stdout.Reset()
+	updateState := CliState{
+		storage:    storage,
+		ioh:        ioh,
+		noInput:    true,
+		updateMode: true,
+	}
+	if err := updateState.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.HasSuffix(files[".env"], "TOKEN=t0ken\nKEY=k3y\nPASSWORD=pa55\n") {
+		t.Fatalf("wrong updated file: %q", files[".env"])
+	}
+	expectDiff := "--- a/.env\n+++ b/.env\n@@ -1,3 +1,4 @@\n+# generated\n USER=alice\n" +
+		" AUTH=" + SecretMask + "\n TOKEN=" + SecretMask + "\n"
+	if stdout.String() != expectDiff {
+		t.Fatalf("wrong diff, expected:\n%v\nbut got:\n%v\n", expectDiff, stdout.String())
+	}
+}
+
+func BenchmarkRunToFile(b *testing.B) {
+	files := map[string]string{
+		"/templates/seed.sql": strings.Repeat("INSERT INTO users (name, email) VALUES ('{NAME}', '{EMAIL}'); -- some comment\n", 100_000),
+	}
+	storage, err := engine.NewStorage(memoryFS(files), "/templates")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ioh := DefaultIOHandler()
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return map[string]string{"NAME": "Alice", "EMAIL": "alice@example.com"}[key], true
+	}
+	output := filepath.Join(b.TempDir(), "seed.sql")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		cliState := CliState{
+			outputFileName: output,
+			templateNames:  []string{"seed.sql"},
+			storage:        storage,
+			ioh:            ioh,
+			noInput:        true,
+		}
+		if err := cliState.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
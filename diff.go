@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// number of unchanged lines around every change in a diff
+const diffContext = 3
+
+type diffOp byte
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// unifiedDiff returns difference between two texts in unified format,
+// or empty string if they are equal
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(lines); {
+		// find next change
+		for start < len(lines) && lines[start].op == diffEqual {
+			start++
+			oldLine++
+			newLine++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// extend hunk while changes are close enough to each other
+		end := start
+		for i := start; i < len(lines); i++ {
+			if lines[i].op != diffEqual {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(lines))
+		hunkOld, hunkNew := oldLine-(start-from), newLine-(start-from)
+
+		var oldCount, newCount int
+		for _, line := range lines[from:to] {
+			if line.op != diffInsert {
+				oldCount++
+			}
+			if line.op != diffDelete {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		for _, line := range lines[from:to] {
+			switch line.op {
+			case diffEqual:
+				sb.WriteString(" ")
+			case diffDelete:
+				sb.WriteString("-")
+			case diffInsert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, line := range lines[start:to] {
+			if line.op != diffInsert {
+				oldLine++
+			}
+			if line.op != diffDelete {
+				newLine++
+			}
+		}
+		start = to
+	}
+
+	return sb.String()
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits text into lines, keeping line breaks
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines finds the shortest list of operations, which turns a into b
+func diffLines(a, b []string) []diffLine {
+	return appendDiff(make([]diffLine, 0, max(len(a), len(b))), a, b)
+}
+
+// appendDiff appends operations for a and b to result. Common prefix and
+// suffix are trimmed first, the rest is split by the middle snake of Myers'
+// algorithm, so memory is linear in the number of lines.
+func appendDiff(result []diffLine, a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		result = append(result, diffLine{diffEqual, a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			result = append(result, diffLine{diffInsert, line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			result = append(result, diffLine{diffDelete, line})
+		}
+	default:
+		x, y := middleSnake(a, b)
+		result = appendDiff(result, a[:x], b[:y])
+		result = appendDiff(result, a[x:], b[y:])
+	}
+
+	for _, line := range tail {
+		result = append(result, diffLine{diffEqual, line})
+	}
+	return result
+}
+
+// middleSnake returns a point, where the shortest paths from the start and
+// from the end of both slices meet, both parts of the slices can be diffed
+// separately. a and b should not be empty.
+func middleSnake(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	// furthest x on every diagonal k = x - y, forward and backward
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[maxD+1], backward[maxD+1] = 0, 0
+
+	delta := n - m
+	// with odd delta paths can meet only after a forward step, with even
+	// delta only after a backward step
+	oddDelta := delta%2 != 0
+	// diagonals, which went out of the slices
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			i := maxD + k
+			var x int
+			if k == -d || (k != d && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[i] = x
+
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case oddDelta:
+				j := maxD + delta - k
+				if j >= 0 && j < len(backward) && backward[j] != -1 && x >= n-backward[j] {
+					return x, y
+				}
+			}
+		}
+
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			i := maxD + k
+			var x int
+			if k == -d || (k != d && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[i] = x
+
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !oddDelta:
+				j := maxD + delta - k
+				if j >= 0 && j < len(forward) && forward[j] != -1 && forward[j] >= n-x {
+					return forward[j], forward[j] - (j - maxD)
+				}
+			}
+		}
+	}
+
+	// nothing in common, all lines of a are deleted and all lines of b are
+	// inserted
+	return n, 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		name    string
+		oldText string
+		newText string
+		expect  string
+	}{
+		{
+			name:    "equal texts",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			expect:  "",
+		},
+		{
+			name:    "new file",
+			oldText: "",
+			newText: "a\nb\n",
+			expect:  "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "changed line",
+			oldText: "a\nb\nc\n",
+			newText: "a\nB\nc\n",
+			expect:  "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "missing new line at the end",
+			oldText: "a\n",
+			newText: "a",
+			expect:  "--- old\n+++ new\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "two hunks",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			newText: "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			expect: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			result := unifiedDiff("old", "new", tt.oldText, tt.newText)
+			if result != tt.expect {
+				t.Fatalf("wrong diff, expected:\n%v\nbut got:\n%v\n", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, random.IntN(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.IntN(4)))
+		}
+		return lines
+	}
+
+	for range 500 {
+		a, b := randomLines(), randomLines()
+		ops := diffLines(a, b)
+
+		var oldLines, newLines []string
+		changes := 0
+		for _, line := range ops {
+			if line.op != diffInsert {
+				oldLines = append(oldLines, line.text)
+			}
+			if line.op != diffDelete {
+				newLines = append(newLines, line.text)
+			}
+			if line.op != diffEqual {
+				changes++
+			}
+		}
+		if !slices.Equal(oldLines, a) || !slices.Equal(newLines, b) {
+			t.Fatalf("diff of %q and %q doesn't restore them: %v", a, b, ops)
+		}
+		if shortest := len(a) + len(b) - 2*lcsLength(a, b); changes != shortest {
+			t.Fatalf("diff of %q and %q has %d changes, but %d is enough", a, b, changes, shortest)
+		}
+	}
+}
+
+func TestDiffLargeText(t *testing.T) {
+	var old strings.Builder
+	for i := range 20000 {
+		fmt.Fprintf(&old, "INSERT INTO users VALUES (%d);\n", i)
+	}
+	newText := strings.Replace(old.String(), "(10000)", "(-1)", 1) + "COMMIT;\n"
+
+	expect := "--- old\n+++ new\n" +
+		"@@ -9998,7 +9998,7 @@\n INSERT INTO users VALUES (9997);\n INSERT INTO users VALUES (9998);\n INSERT INTO users VALUES (9999);\n" +
+		"-INSERT INTO users VALUES (10000);\n+INSERT INTO users VALUES (-1);\n" +
+		" INSERT INTO users VALUES (10001);\n INSERT INTO users VALUES (10002);\n INSERT INTO users VALUES (10003);\n" +
+		"@@ -19998,3 +19998,4 @@\n INSERT INTO users VALUES (19997);\n INSERT INTO users VALUES (19998);\n INSERT INTO users VALUES (19999);\n+COMMIT;\n"
+	if result := unifiedDiff("old", "new", old.String(), newText); result != expect {
+		t.Fatalf("wrong diff, expected:\n%v\nbut got:\n%v\n", expect, result)
+	}
+}
+
+// lcsLength returns length of the longest common subsequence
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return lcs[0][0]
+}
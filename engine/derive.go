@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuiltinPrefix starts names of builtin variables, e.g. {@YEAR}. Like
+// derived variables, they are never asked, their values are computed by
+// ResolveValues.
+const BuiltinPrefix = "@"
+
+// now is replaced in tests
+var now = time.Now
+
+var builtins = map[string]func() string{
+	"@YEAR": func() string { return strconv.Itoa(now().Year()) },
+	"@DATE": func() string { return now().Format(time.DateOnly) },
+}
+
+// derivedVariable is a variable with value from metadata, which is made
+// from other variables, e.g. "value: {PROJECT | snake}"
+type derivedVariable struct {
+	tokens []Token
+	// variables used in the value, and their positions in the header
+	dependencies []string
+	positions    map[string]Position
+}
+
+// IsComputed reports, whether the value of the variable is computed from
+// other variables or is builtin, such variables are never asked
+func (t *Template) IsComputed(name string) bool {
+	_, derived := t.derived[name]
+	return derived || strings.HasPrefix(name, BuiltinPrefix)
+}
+
+// IsSecret reports, whether the variable is secret or its value is derived
+// from secret variables
+func (t *Template) IsSecret(name string) bool {
+	if t.Metadata.Variable(name).Secret {
+		return true
+	}
+	// derived variables don't depend on each other in a cycle
+	return slices.ContainsFunc(t.derived[name].dependencies, t.IsSecret)
+}
+
+// parseDerived parses values of derived variables from metadata and sorts
+// them, so every variable goes after variables it depends on
+func (t *Template) parseDerived() error {
+	t.derived = make(map[string]derivedVariable)
+	var names []string
+	for _, variable := range t.Metadata.Variables {
+		if variable.Value == "" {
+			continue
+		}
+
+		valueTokens := tokens([]byte(variable.Value), variable.valuePosition(), t.Delimiters(), t.Metadata.RawBackslashes)
+		dependencies, positions, err := t.findVariables(slices.Values(valueTokens))
+		if err != nil {
+			return err
+		}
+		t.derived[variable.Name] = derivedVariable{valueTokens, dependencies, positions}
+		names = append(names, variable.Name)
+	}
+
+	// depth-first search, variables on the current path are visiting
+	const (
+		visiting = iota + 1
+		visited
+	)
+	states := make(map[string]int)
+	t.derivedOrder = nil
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch states[name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, name):], name)
+			position := t.Metadata.Variable(cycle[0]).valuePosition()
+			return fmt.Errorf("%s: derived variables depend on each other: %s", t.Location(position), strings.Join(cycle, " -> "))
+		}
+
+		states[name] = visiting
+		for _, dependency := range t.derived[name].dependencies {
+			if _, ok := t.derived[dependency]; !ok {
+				continue
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		states[name] = visited
+		t.derivedOrder = append(t.derivedOrder, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDependencies adds variables, which are used in values of derived
+// variables and in conditions, to the template's variables and sorts them
+// in order of asking
+func (t *Template) addDependencies() {
+	for i := 0; i < len(t.Variables); i++ {
+		// dependencies are asked right after the variable, which needs
+		// them, not derived variables have no dependencies
+		derived := t.derived[t.Variables[i]]
+		dependencies := derived.dependencies
+		if condition := t.Metadata.Variable(t.Variables[i]).If; condition != "" {
+			dependencies = append(slices.Clone(dependencies), condition)
+		}
+
+		next := i + 1
+		for _, dependency := range dependencies {
+			if slices.Contains(t.Variables, dependency) {
+				continue
+			}
+			t.Variables = slices.Insert(t.Variables, next, dependency)
+			next++
+			if position, ok := derived.positions[dependency]; ok {
+				if _, ok := t.positions[dependency]; !ok {
+					t.positions[dependency] = position
+				}
+			}
+		}
+	}
+	t.sortVariables()
+}
+
+// computeValues adds values of builtin and derived variables to values
+func (t *Template) computeValues(values map[string]string) {
+	for _, name := range t.Variables {
+		if builtin, ok := builtins[name]; ok {
+			values[name] = builtin()
+		}
+	}
+
+	for _, name := range t.derivedOrder {
+		if !slices.Contains(t.Variables, name) {
+			continue
+		}
+		var sb strings.Builder
+		for _, token := range t.derived[name].tokens {
+			// writing into strings.Builder has no errors
+			_ = writeToken(&sb, token, values)
+		}
+		values[name] = sb.String()
+	}
+}
+
+// valuePosition returns position of the variable's value in the header,
+// variables from directory configs have no position
+func (v VariableMetadata) valuePosition() Position {
+	if v.valuePos.Line == 0 {
+		return StartPosition
+	}
+	return v.valuePos
+}
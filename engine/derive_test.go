@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDerivedVariables(t *testing.T) {
+	now = func() time.Time {
+		return time.Date(2025, time.March, 4, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() { now = time.Now }()
+
+	testCases := []struct {
+		name      string
+		content   string
+		values    map[string]string
+		variables []string
+		expect    string
+		wantErr   string
+	}{
+		{
+			name:      "value from other variable",
+			content:   "--- sttemp\n[PACKAGE]\nvalue: {PROJECT | snake}\n---\npackage {PACKAGE}\n",
+			values:    map[string]string{"PROJECT": "My App"},
+			variables: []string{"PACKAGE", "PROJECT"},
+			expect:    "package my_app\n",
+		},
+		{
+			name:      "builtins",
+			content:   "--- sttemp\n[YEAR RANGE]\nvalue: {START YEAR}-{@YEAR}\n---\n{YEAR RANGE} {@DATE}\n",
+			values:    map[string]string{"START YEAR": "2020"},
+			variables: []string{"YEAR RANGE", "START YEAR", "@YEAR", "@DATE"},
+			expect:    "2020-2025 2025-03-04\n",
+		},
+		{
+			name:      "variables are computed in order of dependencies",
+			content:   "--- sttemp\n[A]\nvalue: {B}-a\n[B]\nvalue: {C}-b\n---\n{A}\n",
+			values:    map[string]string{"C": "c"},
+			variables: []string{"A", "B", "C"},
+			expect:    "c-b-a\n",
+		},
+		{
+			name:      "derived variable is never asked",
+			content:   "--- sttemp\n[A]\nvalue: {B | upper}\n---\n{A}\n",
+			values:    map[string]string{"A": "wrong", "B": "b"},
+			variables: []string{"A", "B"},
+			expect:    "B\n",
+		},
+		{
+			name:    "cycle",
+			content: "--- sttemp\n[A]\nvalue: {B}\n[B]\nvalue: {A}\n---\n{A}\n",
+			wantErr: "test:3:8: derived variables depend on each other: A -> B -> A",
+		},
+		{
+			name:    "self reference",
+			content: "--- sttemp\n[A]\nvalue:  x{A}\n---\n{A}\n",
+			wantErr: "test:3:9: derived variables depend on each other: A -> A",
+		},
+		{
+			name:    "unknown filter in value",
+			content: "--- sttemp\n[A]\nvalue: {B | shout}\n---\n{A}\n",
+			wantErr: "test:3:8: unknown filter \"shout\"",
+		},
+		{
+			name:    "unknown builtin",
+			content: "{@TIME}",
+			wantErr: "test:1:1: unknown builtin variable \"@TIME\"",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, but got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if strings.Join(template.Variables, ",") != strings.Join(tt.variables, ",") {
+				t.Fatalf("expected variables %q, but got %q", tt.variables, template.Variables)
+			}
+
+			values, err := ResolveValues(template, nil, func(variable VariableMetadata) (string, error) {
+				if template.IsComputed(variable.Name) {
+					t.Fatalf("computed variable %s should not be resolved", variable.Name)
+				}
+				return tt.values[variable.Name], nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if result := template.Fill(values); result != tt.expect {
+				t.Fatalf("expected %q, but got %q", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestSecretDerivedVariables(t *testing.T) {
+	content := "--- sttemp\n[TOKEN]\nsecret: yes\n[AUTH]\nvalue: Bearer {TOKEN}\n[HEADER]\nvalue: Authorization: {AUTH}\n[GREETING]\nvalue: Hello, {NAME}\n---\n{HEADER} {GREETING}\n"
+	template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte(content))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	for name, secret := range map[string]bool{"TOKEN": true, "AUTH": true, "HEADER": true, "GREETING": false, "NAME": false} {
+		if template.IsSecret(name) != secret {
+			t.Errorf("expected IsSecret(%q) to be %v", name, secret)
+		}
+	}
+}
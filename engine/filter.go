@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Placeholder can have filters after the variable name, which change the
+// value, e.g. {APP NAME | kebab}
+const filterSeparator = "|"
+
+// CommandPrefix starts placeholders, which are replaced with output of the
+// command, e.g. {!git rev-parse --short HEAD}. Such placeholders are
+// variables for the engine, the caller decides, whether to run them.
+const CommandPrefix = "!"
+
+// Command returns the command of the variable, if it is a command
+// placeholder
+func Command(name string) (string, bool) {
+	return strings.CutPrefix(name, CommandPrefix)
+}
+
+type filter func(value string) string
+
+var filters = map[string]filter{
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"title":  func(value string) string { return joinWords(value, " ", capitalize) },
+	"kebab":  func(value string) string { return joinWords(value, "-", strings.ToLower) },
+	"snake":  func(value string) string { return joinWords(value, "_", strings.ToLower) },
+	"pascal": func(value string) string { return joinWords(value, "", capitalize) },
+	"camel": func(value string) string {
+		result := words(value)
+		for i, word := range result {
+			if i == 0 {
+				result[i] = strings.ToLower(word)
+			} else {
+				result[i] = capitalize(word)
+			}
+		}
+		return strings.Join(result, "")
+	},
+}
+
+// parsePlaceholder returns the variable name and filters of the placeholder.
+// Name is trimmed only if there are filters, so lint can find whitespaces
+// around names of usual placeholders.
+func parsePlaceholder(content []byte) (name string, filterNames []string) {
+	// commands can have pipes, so they have no filters
+	if bytes.HasPrefix(content, []byte(CommandPrefix)) {
+		return string(content), nil
+	}
+
+	parts := strings.Split(string(content), filterSeparator)
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+
+	for _, filterName := range parts[1:] {
+		filterNames = append(filterNames, strings.TrimSpace(filterName))
+	}
+	return strings.TrimSpace(parts[0]), filterNames
+}
+
+func checkFilters(filterNames []string) error {
+	for _, filterName := range filterNames {
+		if _, ok := filters[filterName]; !ok {
+			return fmt.Errorf("unknown filter %q", filterName)
+		}
+	}
+	return nil
+}
+
+// applyFilters changes value with filters from left to right, filters
+// should be checked by checkFilters
+func applyFilters(value string, filterNames []string) string {
+	for _, filterName := range filterNames {
+		value = filters[filterName](value)
+	}
+	return value
+}
+
+// words splits value by spaces, punctuation and changes from lower to upper
+// case, e.g. "my appName" is "my", "app", "Name"
+func words(value string) []string {
+	var result []string
+	var word []rune
+	var prev rune
+	for _, r := range value {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			r = 0
+		case unicode.IsUpper(r) && unicode.IsLower(prev) && len(word) > 0:
+			result = append(result, string(word))
+			word = nil
+		}
+
+		if r == 0 {
+			if len(word) > 0 {
+				result = append(result, string(word))
+			}
+			word = nil
+		} else {
+			word = append(word, r)
+		}
+		prev = r
+	}
+
+	if len(word) > 0 {
+		result = append(result, string(word))
+	}
+	return result
+}
+
+func joinWords(value string, separator string, transform func(string) string) string {
+	result := words(value)
+	for i, word := range result {
+		result[i] = transform(word)
+	}
+	return strings.Join(result, separator)
+}
+
+func capitalize(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	testCases := []struct {
+		filter string
+		value  string
+		expect string
+	}{
+		{"lower", "My App", "my app"},
+		{"upper", "My App", "MY APP"},
+		{"title", "my app-name", "My App Name"},
+		{"kebab", "My App", "my-app"},
+		{"kebab", "myAppName", "my-app-name"},
+		{"snake", "My App-Name", "my_app_name"},
+		{"pascal", "my app_name", "MyAppName"},
+		{"camel", "My app name", "myAppName"},
+		{"camel", "", ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.filter+" "+tt.value, func(t *testing.T) {
+			result := applyFilters(tt.value, []string{tt.filter})
+			if result != tt.expect {
+				t.Fatalf("expected %q, but got %q", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestPlaceholderFilters(t *testing.T) {
+	template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte("{APP NAME | kebab}/{APP NAME|snake|upper} {APP NAME}"))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if strings.Join(template.Variables, ",") != "APP NAME" {
+		t.Fatalf("expected only APP NAME variable, but got %q", template.Variables)
+	}
+
+	result := template.Fill(map[string]string{"APP NAME": "My App"})
+	if result != "my-app/MY_APP My App" {
+		t.Fatalf("wrong result: %q", result)
+	}
+
+	_, err = NewTemplate(&TemplateFile{Path: "test"}, []byte("\n{NAME | shout}"))
+	expect := "test:2:1: unknown filter \"shout\""
+	if err == nil || err.Error() != expect {
+		t.Fatalf("expected error %q, but got: %v", expect, err)
+	}
+}
+
+func TestCommandPlaceholder(t *testing.T) {
+	template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte("{!git log --oneline | wc -l} {NAME}"))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if strings.Join(template.Variables, ",") != "!git log --oneline | wc -l,NAME" {
+		t.Fatalf("wrong variables: %q", template.Variables)
+	}
+	if command, ok := Command(template.Variables[0]); !ok || command != "git log --oneline | wc -l" {
+		t.Fatalf("wrong command: %q", command)
+	}
+	if _, ok := Command(template.Variables[1]); ok {
+		t.Fatalf("NAME is not a command")
+	}
+
+	result := template.Fill(map[string]string{"!git log --oneline | wc -l": "42", "NAME": "app"})
+	if result != "42 app" {
+		t.Fatalf("wrong result: %q", result)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte("{TITLE}"))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	path := "posts/{DATE}-{TITLE | kebab}.md"
+	if err := template.UsePath(path, "-o "+path); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if strings.Join(template.Variables, ",") != "TITLE,DATE" {
+		t.Fatalf("path variables should be added, but got %q", template.Variables)
+	}
+	if location := template.VariableLocation("DATE"); location != "-o "+path {
+		t.Fatalf("path variables should be located in the path, but got %q", location)
+	}
+	if location := template.VariableLocation("TITLE"); location != "test:1:1" {
+		t.Fatalf("template variables should be located in the template, but got %q", location)
+	}
+
+	result := template.ExpandPath(path, map[string]string{"DATE": "2025-01-02", "TITLE": "Hello World"})
+	if result != "posts/2025-01-02-hello-world.md" {
+		t.Fatalf("wrong path: %q", result)
+	}
+
+	if err := template.UsePath("{A | shout}", "-o"); err == nil {
+		t.Fatalf("expected error for unknown filter")
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// LintIssue is a possible mistake in the template
+type LintIssue struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", li.Path, li.Line, li.Column, li.Message)
+}
+
+// LintError is returned, when --strict is set and template has issues
+type LintError struct {
+	Issues []LintIssue
+}
+
+func (e *LintError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("found %d issues in templates:", len(e.Issues)))
+	for _, issue := range e.Issues {
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Lint looks for placeholders, which probably don't do what the author of
+// the template wanted
+func (t *Template) Lint() []LintIssue {
+	return t.lint(slices.Values(t.Tokens))
+}
+
+// LintReader works as Lint, but reads template from r, which should read
+// the whole template's file
+func (t *Template) LintReader(r io.Reader) ([]LintIssue, error) {
+	scanner, err := t.Scan(r)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := t.lint(scanner.All())
+	return issues, scanner.Err()
+}
+
+func (t *Template) lint(tokens iter.Seq[Token]) []LintIssue {
+	issues := make([]LintIssue, 0)
+	addIssue := func(pos Position, format string, args ...any) {
+		issues = append(issues, LintIssue{t.Path, pos.Line, pos.Column, fmt.Sprintf(format, args...)})
+	}
+
+	delimiters := t.Delimiters()
+	for token := range tokens {
+		switch token.Type {
+		case Unterminated:
+			addIssue(token.Pos, "placeholder %q has no closing delimiter", token.Content)
+		case Variable:
+			name, _ := parsePlaceholder(token.Content)
+			switch {
+			case name == "":
+				addIssue(token.Pos, "empty placeholder")
+			case strings.TrimSpace(name) != name:
+				addIssue(token.Pos, "placeholder %q has leading or trailing whitespace", name)
+			case strings.ContainsAny(name, "\t\r") || strings.Contains(name, "  "):
+				addIssue(token.Pos, "placeholder %q has tabs or repeated spaces", name)
+			}
+		case DanglingEscape:
+			addIssue(token.Pos, "%s escapes nothing and will be printed as is", token.Content)
+		case Text:
+			if !t.Metadata.RawBackslashes {
+				continue
+			}
+			// in raw mode escape before closing delimiter will be printed
+			// as is
+			for idx := range token.Content {
+				rest := token.Content[idx:]
+				if bytes.HasPrefix(rest, delimiters.Escape) && bytes.HasPrefix(rest[len(delimiters.Escape):], delimiters.Close) {
+					addIssue(token.Pos.advance(token.Content[:idx]), "%s escapes nothing and will be printed as is", delimiters.Escape)
+				}
+			}
+		}
+	}
+
+	for _, variable := range t.Metadata.Variables {
+		// variables from directory configs are shared between templates
+		if variable.line != 0 && !slices.Contains(t.Variables, variable.Name) {
+			issues = append(issues, LintIssue{t.Path, variable.line, 1, fmt.Sprintf("variable %q is described in the header, but not used", variable.Name)})
+		}
+	}
+
+	slices.SortFunc(issues, func(a, b LintIssue) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return issues
+}
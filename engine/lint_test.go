@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		issues  []LintIssue
+	}{
+		{
+			name:    "correct template",
+			content: "Hello, {FIRST NAME}! \\{escaped}\nC:\\path\n",
+			issues:  []LintIssue{},
+		},
+		{
+			name:    "unterminated placeholder",
+			content: "first line\nHello, {NAME\n",
+			issues: []LintIssue{
+				{"test", 2, 8, "placeholder \"{NAME\" has no closing delimiter"},
+			},
+		},
+		{
+			name:    "unterminated placeholder at the end",
+			content: "Hello, {NAME",
+			issues: []LintIssue{
+				{"test", 1, 8, "placeholder \"{NAME\" has no closing delimiter"},
+			},
+		},
+		{
+			name:    "empty placeholder",
+			content: "Hello, {}!",
+			issues: []LintIssue{
+				{"test", 1, 8, "empty placeholder"},
+			},
+		},
+		{
+			name:    "whitespaces in names",
+			content: "{ NAME} {FIRST  NAME} {LAST\tNAME}",
+			issues: []LintIssue{
+				{"test", 1, 1, "placeholder \" NAME\" has leading or trailing whitespace"},
+				{"test", 1, 9, "placeholder \"FIRST  NAME\" has tabs or repeated spaces"},
+				{"test", 1, 23, "placeholder \"LAST\\tNAME\" has tabs or repeated spaces"},
+			},
+		},
+		{
+			name:    "dangling escapes",
+			content: "closing \\} and \\\\} the end \\",
+			issues: []LintIssue{
+				{"test", 1, 28, "\\ escapes nothing and will be printed as is"},
+			},
+		},
+		{
+			name:    "escaped escape at the end",
+			content: "the end \\\\",
+			issues:  []LintIssue{},
+		},
+		{
+			name:    "dangling escapes in raw mode",
+			content: "--- sttemp\nraw-backslashes: yes\n---\nclosing \\} and the end \\",
+			issues: []LintIssue{
+				{"test", 4, 9, "\\ escapes nothing and will be printed as is"},
+				{"test", 4, 24, "\\ escapes nothing and will be printed as is"},
+			},
+		},
+		{
+			name:    "unused variables from header",
+			content: "--- sttemp\n[NAME]\ndescription: name\n[EMAIL]\n---\nHello, {NAME}\n{}",
+			issues: []LintIssue{
+				{"test", 4, 1, "variable \"EMAIL\" is described in the header, but not used"},
+				{"test", 7, 1, "empty placeholder"},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			issues := template.Lint()
+			if !reflect.DeepEqual(issues, tt.issues) {
+				t.Fatalf("issues should be\n%v\nbut we got\n%v\n", tt.issues, issues)
+			}
+		})
+	}
+}
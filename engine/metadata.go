@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Template can start with a header, which describes the template and its
+// variables:
+//
+//	--- sttemp
+//	description: MIT license
+//	[NAME]
+//	description: name of the copyright holder
+//	---
+//
+// Keys before the first [VARIABLE] line describe the template itself, keys
+// after it describe the variable. Empty lines and lines started with # are
+// ignored.
+//
+// The same keys can be placed into DirectoryConfigName file, they are used
+// for all templates in the directory and its subdirectories.
+const (
+	metadataStart = "--- sttemp"
+	metadataEnd   = "---"
+)
+
+const DirectoryConfigName = ".sttemp"
+
+type Metadata struct {
+	Description string
+	// nil means default delimiters
+	Delimiters *Delimiters
+	// escape works as in old versions, see tokens
+	RawBackslashes bool
+	// default name of the generated file, it can contain directories
+	Output string
+	// false, if the name of the template's directory is not the default
+	// name, nil means true
+	OutputFromDir *bool
+	// permissions of the generated file, zero means they are taken from
+	// the template's file
+	Mode fs.FileMode
+	// shell commands, which are run after the file is generated
+	Hooks []string
+	// shell commands, which print values of variables before rendering
+	ValuesCommands []string
+	// variables, which are asked first in this order
+	Order     []string
+	Variables []VariableMetadata
+}
+
+type VariableMetadata struct {
+	Name        string
+	Description string
+	// text of the prompt instead of the name
+	Label string
+	// long description, which is printed, when user enters ?
+	Help string
+	// value, which is used when user enters nothing
+	Default string
+	// value made from other variables, e.g. "{PROJECT | snake}", such
+	// variable is never asked
+	Value string
+	// heading, which is printed before the variables of the same group
+	Group string
+	// variable is asked only if this variable is yes
+	If string
+	// value is not echoed, when it is asked, and it is not saved in the
+	// answers file
+	Secret bool
+	// file or shell command, e.g. "pass show github/token", with the value
+	// of a secret variable
+	SecretFile    string
+	SecretCommand string
+	// line of the template, where variable is described, 0 for variables
+	// from directory config
+	line int
+	// position of the value in the header
+	valuePos Position
+}
+
+// Variable returns metadata for variable, or empty metadata if there is
+// nothing about it in the header
+func (m *Metadata) Variable(name string) VariableMetadata {
+	for _, variable := range m.Variables {
+		if variable.Name == name {
+			return variable
+		}
+	}
+	return VariableMetadata{Name: name}
+}
+
+// Merge returns metadata, where missed values are taken from base
+func (m *Metadata) Merge(base *Metadata) *Metadata {
+	if base == nil {
+		return m
+	}
+
+	result := &Metadata{
+		Description: cmp.Or(m.Description, base.Description),
+		Delimiters:  cmp.Or(m.Delimiters, base.Delimiters),
+		// there is no way to turn it off for a single template
+		RawBackslashes: m.RawBackslashes || base.RawBackslashes,
+		Output:         cmp.Or(m.Output, base.Output),
+		OutputFromDir:  cmp.Or(m.OutputFromDir, base.OutputFromDir),
+		Mode:           cmp.Or(m.Mode, base.Mode),
+		// commands of directories are run before template's commands
+		Hooks:          slices.Concat(base.Hooks, m.Hooks),
+		ValuesCommands: slices.Concat(base.ValuesCommands, m.ValuesCommands),
+		Order:          m.Order,
+	}
+	if len(result.Order) == 0 {
+		result.Order = base.Order
+	}
+
+	for _, variable := range base.Variables {
+		variable.line = 0
+		variable.valuePos = Position{}
+		result.Variables = append(result.Variables, variable)
+	}
+
+	for _, variable := range m.Variables {
+		idx := slices.IndexFunc(result.Variables, func(v VariableMetadata) bool {
+			return v.Name == variable.Name
+		})
+		if idx == -1 {
+			result.Variables = append(result.Variables, variable)
+			continue
+		}
+
+		baseVariable := result.Variables[idx]
+		variable.Description = cmp.Or(variable.Description, baseVariable.Description)
+		variable.Default = cmp.Or(variable.Default, baseVariable.Default)
+		if variable.Value == "" {
+			variable.Value = baseVariable.Value
+		}
+		variable.Label = cmp.Or(variable.Label, baseVariable.Label)
+		variable.Help = cmp.Or(variable.Help, baseVariable.Help)
+		variable.Group = cmp.Or(variable.Group, baseVariable.Group)
+		variable.If = cmp.Or(variable.If, baseVariable.If)
+		variable.Secret = variable.Secret || baseVariable.Secret
+		variable.SecretFile = cmp.Or(variable.SecretFile, baseVariable.SecretFile)
+		variable.SecretCommand = cmp.Or(variable.SecretCommand, baseVariable.SecretCommand)
+		result.Variables[idx] = variable
+	}
+
+	return result
+}
+
+// splitMetadata separates template's header from its body, header is nil if
+// template doesn't have one
+func splitMetadata(content []byte) (header []byte, body []byte) {
+	firstLine, rest, found := bytes.Cut(content, []byte("\n"))
+	if !found || string(bytes.TrimRight(firstLine, " \t\r")) != metadataStart {
+		return nil, content
+	}
+
+	for offset := 0; offset < len(rest); {
+		line, _, _ := bytes.Cut(rest[offset:], []byte("\n"))
+		if string(bytes.TrimRight(line, " \t\r")) == metadataEnd {
+			end := min(offset+len(line)+1, len(rest))
+			return rest[:offset], rest[end:]
+		}
+		offset += len(line) + 1
+	}
+
+	return nil, content
+}
+
+// readMetadata reads template's header from r, and returns the header, the
+// reader for the body and position of the body in the template's file
+func readMetadata(r io.Reader) (header []byte, body io.Reader, start Position, err error) {
+	reader := bufio.NewReader(r)
+	if prefix, _ := reader.Peek(len(metadataStart)); string(prefix) != metadataStart {
+		return nil, reader, StartPosition, nil
+	}
+
+	// read lines up to the end of the header
+	var read []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		read = append(read, line...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, StartPosition, err
+		}
+		if len(read) > len(line) && string(bytes.TrimRight(line, " \t\r\n")) == metadataEnd {
+			break
+		}
+	}
+
+	header, rest := splitMetadata(read)
+	body = io.MultiReader(bytes.NewReader(rest), reader)
+	return header, body, StartPosition.advance(read[:len(read)-len(rest)]), nil
+}
+
+// parseMetadata parses header of the template or directory config, path and
+// firstLine are used only in errors
+func parseMetadata(path string, header []byte, firstLine int) (*Metadata, error) {
+	metadata := new(Metadata)
+	var variable *VariableMetadata
+
+	for i, rawLine := range strings.Split(string(header), "\n") {
+		lineNumber := i + firstLine
+		column := len(rawLine) - len(strings.TrimLeft(rawLine, " \t")) + 1
+
+		line := strings.TrimSpace(rawLine)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			metadata.Variables = append(metadata.Variables, VariableMetadata{
+				Name: line[1 : len(line)-1],
+				line: lineNumber,
+			})
+			variable = &metadata.Variables[len(metadata.Variables)-1]
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%s:%d:%d: expected \"key: value\" or \"[VARIABLE]\", but got %q", path, lineNumber, column, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case variable == nil && key == "description":
+			metadata.Description = value
+		case variable == nil && key == "delimiters":
+			delimiters, err := ParseDelimiters(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d: %w", path, lineNumber, column, err)
+			}
+			metadata.Delimiters = delimiters
+		case variable == nil && key == "raw-backslashes":
+			rawBackslashes, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d: %w", path, lineNumber, column, err)
+			}
+			metadata.RawBackslashes = rawBackslashes
+		case variable == nil && key == "output":
+			metadata.Output = value
+		case variable == nil && key == "output-from-dir":
+			outputFromDir, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d: %w", path, lineNumber, column, err)
+			}
+			metadata.OutputFromDir = &outputFromDir
+		case variable == nil && key == "mode":
+			mode, err := parseMode(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d: %w", path, lineNumber, column, err)
+			}
+			metadata.Mode = mode
+		case variable == nil && key == "hook":
+			metadata.Hooks = append(metadata.Hooks, value)
+		case variable == nil && key == "values-command":
+			metadata.ValuesCommands = append(metadata.ValuesCommands, value)
+		case variable == nil && key == "order":
+			for _, name := range strings.Split(value, ",") {
+				metadata.Order = append(metadata.Order, strings.TrimSpace(name))
+			}
+		case variable != nil && key == "description":
+			variable.Description = value
+		case variable != nil && key == "default":
+			variable.Default = value
+		case variable != nil && key == "label":
+			variable.Label = value
+		case variable != nil && key == "help":
+			variable.Help = value
+		case variable != nil && key == "group":
+			variable.Group = value
+		case variable != nil && key == "if":
+			variable.If = value
+		case variable != nil && key == "secret":
+			secret, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d: %w", path, lineNumber, column, err)
+			}
+			variable.Secret = secret
+		case variable != nil && key == "secret-file":
+			variable.Secret = true
+			variable.SecretFile = value
+		case variable != nil && key == "secret-command":
+			variable.Secret = true
+			variable.SecretCommand = value
+		case variable != nil && key == "value":
+			variable.Value = value
+			valueColumn := strings.Index(rawLine, ":") + 1
+			valueColumn += len(rawLine[valueColumn:]) - len(strings.TrimLeft(rawLine[valueColumn:], " \t")) + 1
+			variable.valuePos = Position{Line: lineNumber, Column: valueColumn}
+		default:
+			return nil, fmt.Errorf("%s:%d:%d: unknown key %q", path, lineNumber, column, key)
+		}
+	}
+
+	return metadata, nil
+}
+
+// outputName returns default name of the template, which is declared in
+// metadata or taken from the name of its directory. If metadata says
+// nothing about it, current name is returned.
+func (m *Metadata) outputName(current string, dirName string) string {
+	switch {
+	case m == nil:
+		return current
+	case m.Output != "":
+		return m.Output
+	case m.OutputFromDir == nil:
+		return current
+	case *m.OutputFromDir:
+		return dirName
+	}
+	return ""
+}
+
+// parseMode parses permissions as octal number, e.g. 755
+func parseMode(value string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, fmt.Errorf("expected octal permissions like 755, but got %q", value)
+	}
+	return fs.FileMode(mode), nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "true", "on":
+		return true, nil
+	case "no", "n", "false", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected yes or no, but got %q", value)
+}
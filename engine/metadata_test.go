@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMetadata(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		metadata *Metadata
+		body     string
+		wantErr  string
+	}{
+		{
+			name:     "without header",
+			content:  "Hello, {NAME}!\n",
+			metadata: &Metadata{},
+			body:     "Hello, {NAME}!\n",
+		},
+		{
+			name:     "yaml front matter is not a header",
+			content:  "---\ntitle: {TITLE}\n---\n",
+			metadata: &Metadata{},
+			body:     "---\ntitle: {TITLE}\n---\n",
+		},
+		{
+			name:     "unclosed header is a part of the body",
+			content:  "--- sttemp\ndescription: greeting\n",
+			metadata: &Metadata{},
+			body:     "--- sttemp\ndescription: greeting\n",
+		},
+		{
+			name:    "happy path",
+			content: "--- sttemp\ndescription: greeting\n\n# comment\n[NAME]\ndescription: user's name\n---\nHello, {NAME}!\n",
+			metadata: &Metadata{
+				Description: "greeting",
+				Variables: []VariableMetadata{
+					{Name: "NAME", Description: "user's name", line: 5},
+				},
+			},
+			body: "Hello, {NAME}!\n",
+		},
+		{
+			name:    "prompt of variable",
+			content: "--- sttemp\n[FIRST_NAME]\nlabel: First name\nhelp: name of the copyright holder\n---\n",
+			metadata: &Metadata{
+				Variables: []VariableMetadata{
+					{Name: "FIRST_NAME", Label: "First name", Help: "name of the copyright holder", line: 2},
+				},
+			},
+			body: "",
+		},
+		{
+			name:    "secret variables",
+			content: "--- sttemp\n[PASSWORD]\nsecret: yes\n[TOKEN]\nsecret-command: pass show github/token\n[KEY]\nsecret-file: ~/.ssh/key\n---\n",
+			metadata: &Metadata{
+				Variables: []VariableMetadata{
+					{Name: "PASSWORD", Secret: true, line: 2},
+					{Name: "TOKEN", Secret: true, SecretCommand: "pass show github/token", line: 4},
+					{Name: "KEY", Secret: true, SecretFile: "~/.ssh/key", line: 6},
+				},
+			},
+			body: "",
+		},
+		{
+			name:     "empty body",
+			content:  "--- sttemp\ndescription: empty\n---",
+			metadata: &Metadata{Description: "empty"},
+			body:     "",
+		},
+		{
+			name:     "output name",
+			content:  "--- sttemp\noutput: .github/workflows/ci.yml\n---\n",
+			metadata: &Metadata{Output: ".github/workflows/ci.yml"},
+			body:     "",
+		},
+		{
+			name:     "file mode",
+			content:  "--- sttemp\nmode: 755\n---\n",
+			metadata: &Metadata{Mode: 0o755},
+			body:     "",
+		},
+		{
+			name:     "hooks",
+			content:  "--- sttemp\nhook: go mod tidy\nhook: git init\nvalues-command: cat values\n---\n",
+			metadata: &Metadata{Hooks: []string{"go mod tidy", "git init"}, ValuesCommands: []string{"cat values"}},
+			body:     "",
+		},
+		{
+			name:    "wrong file mode",
+			content: "--- sttemp\nmode: rwx\n---\n",
+			wantErr: "test:2:1: expected octal permissions like 755, but got \"rwx\"",
+		},
+		{
+			name:    "unknown key",
+			content: "--- sttemp\nauthor: me\n---\n",
+			wantErr: "test:2:1: unknown key \"author\"",
+		},
+		{
+			name:    "wrong line",
+			content: "--- sttemp\n[NAME]\nsome text\n---\n",
+			wantErr: "test:3:1: expected \"key: value\" or \"[VARIABLE]\", but got \"some text\"",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, but got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if !reflect.DeepEqual(template.Metadata, tt.metadata) {
+				t.Fatalf("metadata should be\n%#v\nbut we got\n%#v\n", tt.metadata, template.Metadata)
+			}
+
+			_, body := splitMetadata([]byte(tt.content))
+			if string(body) != tt.body {
+				t.Fatalf("body should be %q, but we got %q", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestDefaultName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   map[string]string
+		expect  string
+		initial string
+	}{
+		{
+			name:    "name of the directory",
+			files:   map[string]string{"LICENSE/mit": ""},
+			expect:  "LICENSE",
+			initial: "LICENSE",
+		},
+		{
+			name:    "only the nearest directory is used",
+			files:   map[string]string{"a/b/mit": ""},
+			expect:  "b",
+			initial: "b",
+		},
+		{
+			name:    "declared in the header",
+			files:   map[string]string{"go/mod": "--- sttemp\noutput: go.mod\n---\n"},
+			expect:  "go.mod",
+			initial: "go",
+		},
+		{
+			name: "category directory",
+			files: map[string]string{
+				"go/.sttemp": "output-from-dir: no\n",
+				"go/ci/lint": "",
+			},
+			expect:  "",
+			initial: "",
+		},
+		{
+			name: "declared in the directory config",
+			files: map[string]string{
+				"ci/.sttemp": "output: .gitlab-ci.yml\n",
+				"ci/go":      "",
+			},
+			expect:  ".gitlab-ci.yml",
+			initial: ".gitlab-ci.yml",
+		},
+		{
+			name: "header overrides directory config",
+			files: map[string]string{
+				".sttemp":     "output-from-dir: no\n",
+				"LICENSE/mit": "--- sttemp\noutput-from-dir: yes\n---\n",
+			},
+			expect:  "LICENSE",
+			initial: "",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := make(fstest.MapFS)
+			for name, content := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+			storage, err := NewStorage(fsys, "/templates")
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			var templateFile TemplateFile
+			for _, file := range storage.Templates() {
+				templateFile = file
+			}
+			if templateFile.DefaultName != tt.initial {
+				t.Fatalf("expected default name %q before loading, but got %q", tt.initial, templateFile.DefaultName)
+			}
+
+			template, err := storage.Load(&templateFile)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if template.DefaultName != tt.expect {
+				t.Fatalf("expected default name %q, but got %q", tt.expect, template.DefaultName)
+			}
+		})
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	testCases := []struct {
+		name   string
+		files  fstest.MapFS
+		expect fs.FileMode
+	}{
+		{
+			name:   "usual template",
+			files:  fstest.MapFS{"go/main": {Data: []byte(""), Mode: 0o644}},
+			expect: 0o666,
+		},
+		{
+			name:   "executable template",
+			files:  fstest.MapFS{"sh/script": {Data: []byte(""), Mode: 0o750}},
+			expect: 0o777,
+		},
+		{
+			name:   "declared in the header",
+			files:  fstest.MapFS{"env/dotenv": {Data: []byte("--- sttemp\nmode: 600\n---\n"), Mode: 0o755}},
+			expect: 0o600,
+		},
+		{
+			name: "declared in the directory config",
+			files: fstest.MapFS{
+				"bin/.sttemp": {Data: []byte("mode: 700\n")},
+				"bin/run":     {Data: []byte("")},
+			},
+			expect: 0o700,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewStorage(tt.files, "/templates")
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			templateFile := storage.Templates()[0]
+			template, err := storage.Load(&templateFile)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if mode := template.FileMode(); mode != tt.expect {
+				t.Fatalf("expected mode %o, but got %o", tt.expect, mode)
+			}
+		})
+	}
+}
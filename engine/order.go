@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+)
+
+// sortVariables sorts variables in order of asking. By default it is the
+// order of the first appearance in the template, variables from the order
+// key of metadata go first, variables of the same group are asked together,
+// and conditional variables are asked after their conditions.
+func (t *Template) sortVariables() {
+	order := t.Metadata.Order
+	slices.SortStableFunc(t.Variables, func(a, b string) int {
+		aIdx, bIdx := slices.Index(order, a), slices.Index(order, b)
+		switch {
+		case aIdx == -1 && bIdx == -1:
+			return 0
+		case aIdx == -1:
+			return 1
+		case bIdx == -1:
+			return -1
+		}
+		return aIdx - bIdx
+	})
+
+	// every group is placed at the position of its first variable
+	grouped := make([]string, 0, len(t.Variables))
+	for _, name := range t.Variables {
+		group := t.Metadata.Variable(name).Group
+		if group == "" {
+			grouped = append(grouped, name)
+			continue
+		}
+		if slices.Contains(grouped, name) {
+			continue
+		}
+		for _, other := range t.Variables {
+			if t.Metadata.Variable(other).Group == group {
+				grouped = append(grouped, other)
+			}
+		}
+	}
+	t.Variables = grouped
+
+	// every condition is moved only once, so conditions, which depend on
+	// each other, don't move forever
+	moved := make(map[string]bool)
+	for i := 0; i < len(t.Variables); i++ {
+		condition := t.Metadata.Variable(t.Variables[i]).If
+		conditionIdx := slices.Index(t.Variables, condition)
+		if conditionIdx > i && !moved[condition] {
+			// move the condition before the variable, which depends on it
+			t.Variables = slices.Insert(slices.Delete(t.Variables, conditionIdx, conditionIdx+1), i, condition)
+			moved[condition] = true
+			i--
+		}
+	}
+}
+
+// conditionMet reports, whether the variable should be asked. Variable with
+// a condition is asked only if the value of the condition is yes, y, true or
+// on.
+func conditionMet(variable VariableMetadata, values map[string]string) bool {
+	if variable.If == "" {
+		return true
+	}
+	value, _ := parseBool(strings.TrimSpace(values[variable.If]))
+	return value
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVariableOrder(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		variables []string
+	}{
+		{
+			name:      "order of appearance",
+			content:   "{NAME} {AUTHOR} {DESCRIPTION} {AUTHOR} {LICENSE}",
+			variables: []string{"NAME", "AUTHOR", "DESCRIPTION", "LICENSE"},
+		},
+		{
+			name:      "explicit order",
+			content:   "--- sttemp\norder: LICENSE, AUTHOR, MISSING\n---\n{NAME} {AUTHOR} {DESCRIPTION} {LICENSE}",
+			variables: []string{"LICENSE", "AUTHOR", "NAME", "DESCRIPTION"},
+		},
+		{
+			name:      "groups",
+			content:   "--- sttemp\n[HOST]\ngroup: Server\n[PORT]\ngroup: Server\n---\n{HOST} {NAME} {PORT}",
+			variables: []string{"HOST", "PORT", "NAME"},
+		},
+		{
+			name:      "condition is asked first",
+			content:   "--- sttemp\n[REGISTRY]\nif: DOCKER\n---\n{REGISTRY} {NAME} {DOCKER}",
+			variables: []string{"DOCKER", "REGISTRY", "NAME"},
+		},
+		{
+			name:      "condition, which is not in the template",
+			content:   "--- sttemp\n[REGISTRY]\nif: DOCKER\n---\n{NAME} {REGISTRY}",
+			variables: []string{"NAME", "DOCKER", "REGISTRY"},
+		},
+		{
+			name:      "conditions depend on each other",
+			content:   "--- sttemp\n[A]\nif: B\n[B]\nif: A\n---\n{A} {B}",
+			variables: []string{"A", "B"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{Path: "test"}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !slices.Equal(template.Variables, tt.variables) {
+				t.Fatalf("expected variables %q, but got %q", tt.variables, template.Variables)
+			}
+		})
+	}
+}
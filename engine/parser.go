@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+type Token struct {
+	Type    TokenType
+	Content []byte
+	// position of the first byte of the token in the template's file
+	Pos Position
+}
+
+// Position is a place in the template's file
+type Position struct {
+	// byte offset, starting from 0
+	Offset int
+	// line number, starting from 1
+	Line int
+	// byte offset in the line, starting from 1
+	Column int
+}
+
+// StartPosition is a position of the first byte of the file
+var StartPosition = Position{Offset: 0, Line: 1, Column: 1}
+
+// next returns position of the byte after c
+func (p Position) next(c byte) Position {
+	if c == '\n' {
+		return Position{p.Offset + 1, p.Line + 1, 1}
+	}
+	return Position{p.Offset + 1, p.Line, p.Column + 1}
+}
+
+// advance returns position after all bytes of content
+func (p Position) advance(content []byte) Position {
+	for _, c := range content {
+		p = p.next(c)
+	}
+	return p
+}
+
+type TokenType byte
+
+const (
+	Text TokenType = iota
+	Variable
+	// placeholder without closing bracket, it is rendered as a text
+	Unterminated
+	// escape at the end of the template, which escapes nothing, it is
+	// rendered as a text
+	DanglingEscape
+)
+
+// Delimiters describe how placeholders look in the template
+type Delimiters struct {
+	Open  []byte
+	Close []byte
+	// escape before any delimiter or another escape turns it into a text
+	Escape []byte
+}
+
+var DefaultDelimiters = Delimiters{[]byte("{"), []byte("}"), []byte("\\")}
+
+// ParseDelimiters parses delimiters in the form of "open close [escape]"
+func ParseDelimiters(value string) (*Delimiters, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("delimiters should be \"open close\" or \"open close escape\", but got %q", value)
+	}
+
+	delimiters := &Delimiters{[]byte(fields[0]), []byte(fields[1]), DefaultDelimiters.Escape}
+	if len(fields) == 3 {
+		delimiters.Escape = []byte(fields[2])
+	}
+	return delimiters, nil
+}
+
+func (d Delimiters) String() string {
+	return string(d.Open) + " " + string(d.Close) + " " + string(d.Escape)
+}
+
+// maximum length of a text token, longer texts are split into a few tokens
+// to keep memory usage bounded
+const maxTextLength = 32 * 1024
+
+// Scanner reads tokens one by one from the stream, so templates of any size
+// can be rendered without reading them into memory.
+//
+// Escape before opening or closing delimiter or before another escape is
+// removed, and the next sequence is printed as is. Escape before anything
+// else is a text. In raw mode, which was the only one in old versions,
+// escape works only before opening delimiter and it hides the next byte
+// after itself from parsing.
+type Scanner struct {
+	reader     *bufio.Reader
+	delimiters Delimiters
+	raw        bool
+	// position of the next byte in the reader
+	pos Position
+	// text, which is not returned yet
+	text    []byte
+	textPos Position
+	// tokens, which are ready to be returned
+	ready []Token
+	err   error
+}
+
+// NewScanner creates scanner for the reader, start is a position of the
+// reader's content in the template's file
+func NewScanner(r io.Reader, start Position, delimiters Delimiters, raw bool) *Scanner {
+	return &Scanner{
+		reader:     bufio.NewReader(r),
+		delimiters: delimiters,
+		raw:        raw,
+		pos:        start,
+	}
+}
+
+// Next returns the next token, or io.EOF if there are no tokens anymore
+func (s *Scanner) Next() (Token, error) {
+	for len(s.ready) == 0 {
+		if s.err != nil {
+			return Token{}, s.err
+		}
+		s.scan()
+	}
+
+	token := s.ready[0]
+	s.ready = s.ready[1:]
+	return token, nil
+}
+
+func (s *Scanner) scan() {
+	delimiters := s.delimiters
+	switch {
+	case s.hasPrefix(delimiters.Open):
+		s.flushText()
+		s.scanVariable()
+	case s.isDangling():
+		s.flushText()
+		start := s.pos
+		escape, _ := s.read(len(delimiters.Escape))
+		s.ready = append(s.ready, Token{DanglingEscape, escape, start})
+	case s.raw && s.hasPrefix(delimiters.Escape):
+		if s.isEscaped(delimiters.Open) {
+			s.flushText()
+			s.skip(len(delimiters.Escape))
+			s.readText(len(delimiters.Open))
+		} else {
+			s.readText(len(delimiters.Escape) + 1)
+		}
+	case !s.raw && s.hasPrefix(delimiters.Escape):
+		// text is split on removed escapes, so positions inside text
+		// tokens can be calculated from their content
+		escaped := s.escapedLength()
+		if escaped > 0 {
+			s.flushText()
+			s.skip(len(delimiters.Escape))
+		}
+		s.readText(max(escaped, 1))
+	default:
+		s.readPlainText()
+	}
+}
+
+// readPlainText reads buffered bytes up to the next possible delimiter or
+// escape at once
+func (s *Scanner) readPlainText() {
+	peek, _ := s.reader.Peek(max(s.reader.Buffered(), 1))
+	if len(peek) == 0 {
+		s.readText(1)
+		return
+	}
+
+	n := 1
+	for n < len(peek) && peek[n] != s.delimiters.Open[0] && peek[n] != s.delimiters.Escape[0] {
+		n++
+	}
+
+	if len(s.text) == 0 {
+		s.textPos = s.pos
+	}
+	s.text = append(s.text, peek[:n]...)
+	s.pos = s.pos.advance(peek[:n])
+	// peeked bytes can always be discarded
+	_, _ = s.reader.Discard(n)
+
+	if len(s.text) >= maxTextLength {
+		s.flushText()
+	}
+}
+
+// scanVariable reads a placeholder, which starts at the current position
+func (s *Scanner) scanVariable() {
+	start := s.pos
+	open, _ := s.read(len(s.delimiters.Open))
+	content := bytes.Clone(open)
+
+	for {
+		if s.hasPrefix(s.delimiters.Close) {
+			s.skip(len(s.delimiters.Close))
+			variable := content[len(s.delimiters.Open):]
+			s.ready = append(s.ready, Token{Variable, variable, start})
+			return
+		}
+
+		c, err := s.reader.ReadByte()
+		if err == nil && c == '\n' {
+			// newline is a part of the next text
+			err = s.reader.UnreadByte()
+		} else if err == nil {
+			s.pos = s.pos.next(c)
+			content = append(content, c)
+			continue
+		}
+
+		s.ready = append(s.ready, Token{Unterminated, content, start})
+		if err != nil {
+			s.err = err
+		}
+		return
+	}
+}
+
+// escapedLength returns length of the sequence after escape, which is
+// escaped by it, or 0 if it escapes nothing
+func (s *Scanner) escapedLength() int {
+	for _, escaped := range [][]byte{s.delimiters.Open, s.delimiters.Close, s.delimiters.Escape} {
+		if s.isEscaped(escaped) {
+			return len(escaped)
+		}
+	}
+	return 0
+}
+
+// isEscaped checks, if the reader starts with escape and sequence after it
+func (s *Scanner) isEscaped(sequence []byte) bool {
+	escapeLen := len(s.delimiters.Escape)
+	peek, _ := s.reader.Peek(escapeLen + len(sequence))
+	return len(peek) == escapeLen+len(sequence) && bytes.Equal(peek[escapeLen:], sequence)
+}
+
+// isDangling checks, if the reader has only escape left
+func (s *Scanner) isDangling() bool {
+	escapeLen := len(s.delimiters.Escape)
+	peek, _ := s.reader.Peek(escapeLen + 1)
+	return len(peek) == escapeLen && bytes.Equal(peek, s.delimiters.Escape)
+}
+
+func (s *Scanner) hasPrefix(prefix []byte) bool {
+	peek, _ := s.reader.Peek(len(prefix))
+	return len(peek) == len(prefix) && bytes.Equal(peek, prefix)
+}
+
+// read reads n bytes or less, if reader has no more bytes
+func (s *Scanner) read(n int) ([]byte, error) {
+	content := make([]byte, n)
+	n, err := io.ReadFull(s.reader, content)
+	s.pos = s.pos.advance(content[:n])
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return content[:n], err
+}
+
+func (s *Scanner) skip(n int) {
+	_, s.err = s.read(n)
+	if s.err == io.EOF {
+		// nothing to skip is not an error yet, next read returns EOF
+		s.err = nil
+	}
+}
+
+// readText reads n bytes and adds them to the text
+func (s *Scanner) readText(n int) {
+	if len(s.text) == 0 {
+		s.textPos = s.pos
+	}
+
+	for range n {
+		c, err := s.reader.ReadByte()
+		if err != nil {
+			s.flushText()
+			s.err = err
+			return
+		}
+		s.text = append(s.text, c)
+		s.pos = s.pos.next(c)
+	}
+
+	if len(s.text) >= maxTextLength {
+		s.flushText()
+	}
+}
+
+func (s *Scanner) flushText() {
+	if len(s.text) == 0 {
+		return
+	}
+	s.ready = append(s.ready, Token{Text, s.text, s.textPos})
+	s.text = nil
+}
+
+// All returns all tokens, which are left in the reader, use Err after
+// iteration to check for errors
+func (s *Scanner) All() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for {
+			token, err := s.Next()
+			if err != nil || !yield(token) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the first error except io.EOF, which scanner got from the
+// reader
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// tokens splits content into tokens, start is a position of the content
+// in the template's file
+func tokens(content []byte, start Position, delimiters Delimiters, raw bool) []Token {
+	tokens := make([]Token, 0)
+	// reading from memory has no errors except io.EOF
+	scanner := NewScanner(bytes.NewReader(content), start, delimiters, raw)
+	for token := range scanner.All() {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Resolver returns value for the variable. If there is no value, it should
+// return an error wrapping ErrMissingVariable, then ResolveValues checks all
+// other variables and reports all missing ones at once.
+type Resolver func(variable VariableMetadata) (string, error)
+
+// ErrMissingVariable is returned, when variable has no value
+var ErrMissingVariable = errors.New("variable is not set")
+
+// MissingVariablesError lists all variables without values, so user can
+// set all of them at once
+type MissingVariablesError struct {
+	Variables []MissingVariable
+}
+
+type MissingVariable struct {
+	Name string
+	// location of the first usage of the variable in the template
+	Location string
+}
+
+func (e *MissingVariablesError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("variables are not set:")
+	for _, missing := range e.Variables {
+		fmt.Fprintf(&sb, "\n  %s: %s", missing.Location, missing.Name)
+	}
+	return sb.String()
+}
+
+func (e *MissingVariablesError) Unwrap() error {
+	return ErrMissingVariable
+}
+
+// ResolveValues returns values for all template's variables, known values
+// are used as is, others are taken from resolve. Values of builtin and
+// derived variables are always computed after all others.
+func ResolveValues(template *Template, known map[string]string, resolve Resolver) (map[string]string, error) {
+	values := make(map[string]string, len(template.Variables))
+	var missing []MissingVariable
+	for _, variable := range template.Variables {
+		if template.IsComputed(variable) {
+			continue
+		}
+		if value, ok := known[variable]; ok {
+			values[variable] = value
+			continue
+		}
+
+		metadata := template.Metadata.Variable(variable)
+		if !conditionMet(metadata, values) {
+			values[variable] = ""
+			continue
+		}
+
+		value, err := resolve(metadata)
+		location := template.VariableLocation(variable)
+		if errors.Is(err, ErrMissingVariable) {
+			missing = append(missing, MissingVariable{variable, location})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: can't get value for %s: %w", location, variable, err)
+		}
+		values[variable] = value
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingVariablesError{missing}
+	}
+
+	template.computeValues(values)
+	return values, nil
+}
@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// errors of Lookup, they are wrapped with the name of the template
+var (
+	ErrTemplateNotFound  = errors.New("not found")
+	ErrAmbiguousTemplate = errors.New("is ambiguous")
+)
+
+// Storage represent a directory with all templates. Templates are read from
+// fsys, dir is the path of this directory, which is used for template's paths
+// in messages and errors.
+type Storage struct {
+	fsys fs.FS
+	dir  string
+	// file systems of mounted namespaces
+	mounts map[string]fs.FS
+	// templates sorted by name
+	templates []TemplateFile
+}
+
+func NewStorage(fsys fs.FS, dir string) (*Storage, error) {
+	templateFiles, err := findTemplateFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &Storage{
+		fsys:      fsys,
+		dir:       dir,
+		mounts:    make(map[string]fs.FS),
+		templates: templateFiles,
+	}
+	return storage, nil
+}
+
+// Mount adds templates from fsys into the storage, their names are prefixed
+// with namespace, e.g. "company/mit"
+func (s *Storage) Mount(namespace string, fsys fs.FS, dir string) error {
+	if _, ok := s.mounts[namespace]; ok {
+		return fmt.Errorf("namespace %s is already mounted", namespace)
+	}
+
+	templateFiles, err := findTemplateFiles(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, templateFile := range templateFiles {
+		templateFile.Name = namespace + "/" + templateFile.Name
+		templateFile.namespace = namespace
+		s.templates = append(s.templates, templateFile)
+	}
+	sortTemplateFiles(s.templates)
+	s.mounts[namespace] = fsys
+	return nil
+}
+
+// Dir returns path of the storage's directory
+func (s *Storage) Dir() string {
+	return s.dir
+}
+
+// Lookup returns template file by its name. Name can be the full name of
+// the template or the ending of it, e.g. "mit" for "LICENSE/mit", if only
+// one template has such ending.
+func (s *Storage) Lookup(name string) (TemplateFile, error) {
+	var found []TemplateFile
+	for _, templateFile := range s.templates {
+		if templateFile.Name == name {
+			found = append(found, templateFile)
+		}
+	}
+
+	if len(found) == 0 {
+		for _, templateFile := range s.templates {
+			if templateFile.matches(name) {
+				found = append(found, templateFile)
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return TemplateFile{}, fmt.Errorf("template %s %w", name, ErrTemplateNotFound)
+	case 1:
+		return found[0], nil
+	}
+
+	names := make([]string, 0, len(found))
+	for _, templateFile := range found {
+		names = append(names, templateFile.Name)
+	}
+	return TemplateFile{}, fmt.Errorf("template %s %w, it can be: %s", name, ErrAmbiguousTemplate, strings.Join(names, ", "))
+}
+
+// Templates returns all template files sorted by name
+func (s *Storage) Templates() []TemplateFile {
+	return slices.Clone(s.templates)
+}
+
+// Open opens template's file for reading
+func (s *Storage) Open(templateFile *TemplateFile) (io.ReadCloser, error) {
+	return s.fileSystem(templateFile).Open(templateFile.fsPath)
+}
+
+func (s *Storage) fileSystem(templateFile *TemplateFile) fs.FS {
+	if templateFile.namespace == "" {
+		return s.fsys
+	}
+	return s.mounts[templateFile.namespace]
+}
+
+// Load reads template's metadata and variables without keeping its content
+// in memory
+func (s *Storage) Load(templateFile *TemplateFile) (*Template, error) {
+	reader, err := s.Open(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ScanTemplate(templateFile, reader)
+}
+
+// Read reads the whole template into memory
+func (s *Storage) Read(templateFile *TemplateFile) (*Template, error) {
+	content, err := fs.ReadFile(s.fileSystem(templateFile), templateFile.fsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTemplate(templateFile, content)
+}
+
+// Render writes the template loaded from the storage with values to w
+func (s *Storage) Render(w io.Writer, template *Template, values map[string]string) error {
+	reader, err := s.Open(template.TemplateFile)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return template.Render(w, reader, values)
+}
+
+// Lint returns issues of the template loaded from the storage
+func (s *Storage) Lint(template *Template) ([]LintIssue, error) {
+	reader, err := s.Open(template.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return template.LintReader(reader)
+}
+
+// Execute renders template with the name into w, values of variables are
+// taken from resolve
+func (s *Storage) Execute(w io.Writer, name string, resolve Resolver) error {
+	templateFile, err := s.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	template, err := s.Load(&templateFile)
+	if err != nil {
+		return err
+	}
+
+	values, err := ResolveValues(template, nil, resolve)
+	if err != nil {
+		return err
+	}
+
+	return s.Render(w, template, values)
+}
+
+func findTemplateFiles(fsys fs.FS, dir string) ([]TemplateFile, error) {
+	templateFiles := make([]TemplateFile, 0)
+	configs := make(map[string]*Metadata)
+	err := fs.WalkDir(fsys, ".", func(fsPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() && fsPath != "." && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+
+		filePath := filepath.Join(dir, filepath.FromSlash(fsPath))
+		if !d.IsDir() && d.Name() == DirectoryConfigName {
+			content, err := fs.ReadFile(fsys, fsPath)
+			if err != nil {
+				return err
+			}
+			configs[path.Dir(fsPath)], err = parseMetadata(filePath, content, 1)
+			return err
+		}
+
+		if !d.IsDir() {
+			templateFile, err := NewTemplateFile(filePath, dir)
+			if err != nil {
+				return err
+			}
+			templateFile.fsPath = fsPath
+			// stat follows symlinks unlike d.Info
+			info, err := fs.Stat(fsys, fsPath)
+			if err != nil {
+				return err
+			}
+			templateFile.Mode = info.Mode().Perm()
+			templateFiles = append(templateFiles, *templateFile)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, templateFile := range templateFiles {
+		dirMetadata := directoryMetadata(configs, path.Dir(templateFile.fsPath))
+		templateFiles[i].DirMetadata = dirMetadata
+		templateFiles[i].DefaultName = dirMetadata.outputName(templateFile.dirName, templateFile.dirName)
+	}
+
+	sortTemplateFiles(templateFiles)
+	return templateFiles, nil
+}
+
+func sortTemplateFiles(templateFiles []TemplateFile) {
+	slices.SortFunc(templateFiles, func(a, b TemplateFile) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// directoryMetadata merges configs from the root directory of the storage
+// down to dir, configs of subdirectories override their parents
+func directoryMetadata(configs map[string]*Metadata, dir string) *Metadata {
+	var metadata *Metadata
+	if dir != "." {
+		metadata = directoryMetadata(configs, path.Dir(dir))
+	}
+
+	config, ok := configs[dir]
+	if !ok {
+		return metadata
+	}
+	return config.Merge(metadata)
+}
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// errorFS returns errors for some files, it doesn't embed fstest.MapFS to
+// hide its ReadDir
+type errorFS struct {
+	fsys   fstest.MapFS
+	errors map[string]error
+}
+
+func (e errorFS) Open(name string) (fs.File, error) {
+	if err, ok := e.errors[name]; ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return e.fsys.Open(name)
+}
+
+func TestStorageTemplates(t *testing.T) {
+	testCases := []struct {
+		name   string
+		fsys   fs.FS
+		expect []TemplateFile
+		err    error
+	}{
+		{
+			name:   "empty directory",
+			fsys:   fstest.MapFS{},
+			expect: []TemplateFile{},
+			err:    nil,
+		},
+		{
+			name: "happy path",
+			fsys: fstest.MapFS{
+				"first":       {},
+				"LICENSE/mit": {},
+				"LICENSE/gpl": {},
+			},
+			expect: []TemplateFile{
+				{
+					Name:        "LICENSE/gpl",
+					DefaultName: "LICENSE",
+					Path:        "/templates/LICENSE/gpl",
+					fsPath:      "LICENSE/gpl",
+					dir:         "/templates",
+					dirName:     "LICENSE",
+				},
+				{
+					Name:        "LICENSE/mit",
+					DefaultName: "LICENSE",
+					Path:        "/templates/LICENSE/mit",
+					fsPath:      "LICENSE/mit",
+					dir:         "/templates",
+					dirName:     "LICENSE",
+				},
+				{
+					Name:        "first",
+					DefaultName: "",
+					Path:        "/templates/first",
+					fsPath:      "first",
+					dir:         "/templates",
+				},
+			},
+			err: nil,
+		},
+		{
+			name: "skip hidden dir",
+			fsys: fstest.MapFS{
+				".config/first": {},
+			},
+			expect: []TemplateFile{},
+			err:    nil,
+		},
+		{
+			name: "return fs errors as is (except permissions errors)",
+			fsys: errorFS{
+				fsys:   fstest.MapFS{"subdir/first": {}},
+				errors: map[string]error{"subdir": fs.ErrInvalid},
+			},
+			expect: nil,
+			err:    fs.ErrInvalid,
+		},
+		{
+			name: "ignore permissions errors",
+			fsys: errorFS{
+				fsys:   fstest.MapFS{"first": {}, "subdir/second": {}},
+				errors: map[string]error{"subdir": fs.ErrPermission},
+			},
+			expect: []TemplateFile{
+				{
+					Name:        "first",
+					DefaultName: "",
+					Path:        "/templates/first",
+					fsPath:      "first",
+					dir:         "/templates",
+				},
+			},
+			err: nil,
+		},
+		{
+			name: "directory configs",
+			fsys: fstest.MapFS{
+				".sttemp":      {Data: []byte("[AUTHOR]\ndefault: Alice\n")},
+				"first":        {},
+				"json/.sttemp": {Data: []byte("delimiters: << >>\n")},
+				"json/second":  {},
+			},
+			expect: []TemplateFile{
+				{
+					Name:        "first",
+					DefaultName: "",
+					Path:        "/templates/first",
+					DirMetadata: &Metadata{
+						Variables: []VariableMetadata{{Name: "AUTHOR", Default: "Alice", line: 1}},
+					},
+					fsPath: "first",
+					dir:    "/templates",
+				},
+				{
+					Name:        "json/second",
+					DefaultName: "json",
+					Path:        "/templates/json/second",
+					DirMetadata: &Metadata{
+						Delimiters: &Delimiters{[]byte("<<"), []byte(">>"), []byte("\\")},
+						Variables:  []VariableMetadata{{Name: "AUTHOR", Default: "Alice"}},
+					},
+					fsPath:  "json/second",
+					dir:     "/templates",
+					dirName: "json",
+				},
+			},
+			err: nil,
+		},
+		{
+			name: "two templates with the same file name",
+			fsys: fstest.MapFS{
+				"first":        {},
+				"subdir/first": {},
+			},
+			expect: []TemplateFile{
+				{
+					Name:        "first",
+					DefaultName: "",
+					Path:        "/templates/first",
+					fsPath:      "first",
+					dir:         "/templates",
+				},
+				{
+					Name:        "subdir/first",
+					DefaultName: "subdir",
+					Path:        "/templates/subdir/first",
+					fsPath:      "subdir/first",
+					dir:         "/templates",
+					dirName:     "subdir",
+				},
+			},
+			err: nil,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewStorage(tt.fsys, "/templates")
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err should be \n%v\nbut we got\n%v\n", tt.err, err)
+			}
+
+			if tt.err == nil && !reflect.DeepEqual(tt.expect, storage.templates) {
+				t.Fatalf("Storage should contain\n%#v\nbut we got %#v\n", tt.expect, storage.templates)
+			}
+		})
+	}
+}
+
+func TestStorageExecute(t *testing.T) {
+	storage, err := NewStorage(fstest.MapFS{
+		"LICENSE/mit": {Data: []byte("--- sttemp\n[YEAR]\ndefault: 2025\n---\nCopyright {YEAR} {NAME}\n")},
+	}, "/templates")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	resolve := func(variable VariableMetadata) (string, error) {
+		if variable.Name == "NAME" {
+			return "Alice", nil
+		}
+		return variable.Default, nil
+	}
+
+	var result bytes.Buffer
+	if err := storage.Execute(&result, "mit", resolve); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expect := "Copyright 2025 Alice\n"
+	if result.String() != expect {
+		t.Fatalf("expected %q, but got %q", expect, result.String())
+	}
+
+	// all missing variables are reported at once
+	missing := func(variable VariableMetadata) (string, error) {
+		return "", ErrMissingVariable
+	}
+	err = storage.Execute(&result, "mit", missing)
+
+	var missingErr *MissingVariablesError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("expected MissingVariablesError, but got: %v", err)
+	}
+	expectErr := "variables are not set:\n  /templates/LICENSE/mit:5:11: YEAR\n  /templates/LICENSE/mit:5:18: NAME"
+	if err.Error() != expectErr {
+		t.Fatalf("expected error:\n%v\nbut got:\n%v", expectErr, err)
+	}
+}
+
+func TestStorageMount(t *testing.T) {
+	storage, err := NewStorage(fstest.MapFS{"LICENSE/mit": {Data: []byte("local")}}, "/templates")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	err = storage.Mount("company", fstest.MapFS{"LICENSE/mit": {Data: []byte("company")}}, "/templates/.packs/company")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	for name, expect := range map[string]string{"LICENSE/mit": "local", "company/mit": "company"} {
+		templateFile, err := storage.Lookup(name)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		template, err := storage.Read(&templateFile)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if string(template.Content) != expect {
+			t.Fatalf("expected %q for %s, but got %q", expect, name, template.Content)
+		}
+	}
+
+	templateFile, _ := storage.Lookup("company/mit")
+	if templateFile.Name != "company/LICENSE/mit" || templateFile.Path != "/templates/.packs/company/LICENSE/mit" || templateFile.DefaultName != "LICENSE" {
+		t.Fatalf("wrong template file: %#v", templateFile)
+	}
+
+	if err := storage.Mount("company", fstest.MapFS{}, "/templates/.packs/company"); err == nil {
+		t.Fatalf("namespace can't be mounted twice")
+	}
+}
+
+func TestStorageLookup(t *testing.T) {
+	storage, err := NewStorage(fstest.MapFS{
+		"LICENSE/mit": {},
+		"docs/mit":    {},
+		"docs/readme": {},
+		"go/mod":      {},
+		"mod":         {},
+	}, "/templates")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if err := storage.Mount("company", fstest.MapFS{"LICENSE/apache": {}}, "/templates/.packs/company"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		expect string
+		err    error
+	}{
+		{name: "LICENSE/mit", expect: "LICENSE/mit"},
+		{name: "docs/mit", expect: "docs/mit"},
+		{name: "readme", expect: "docs/readme"},
+		// full name is preferred over the ending of other names
+		{name: "mod", expect: "mod"},
+		{name: "go/mod", expect: "go/mod"},
+		{name: "apache", expect: "company/LICENSE/apache"},
+		{name: "company/apache", expect: "company/LICENSE/apache"},
+		{name: "LICENSE/apache", expect: "company/LICENSE/apache"},
+		{name: "mit", err: ErrAmbiguousTemplate},
+		{name: "gpl", err: ErrTemplateNotFound},
+		{name: "SE/mit", err: ErrTemplateNotFound},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			templateFile, err := storage.Lookup(tt.name)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, but got: %v", tt.err, err)
+			}
+			if templateFile.Name != tt.expect {
+				t.Fatalf("expected %q, but got %q", tt.expect, templateFile.Name)
+			}
+		})
+	}
+
+	_, err = storage.Lookup("mit")
+	expect := "template mit is ambiguous, it can be: LICENSE/mit, docs/mit"
+	if err.Error() != expect {
+		t.Fatalf("expected error:\n%v\nbut got:\n%v", expect, err)
+	}
+}
@@ -0,0 +1,395 @@
+// Package engine parses and renders sttemp templates, and finds them in
+// the storage directory. The sttemp command is built on top of it.
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type TemplateFile struct {
+	// path of the file relative to the storage with forward slashes,
+	// templates from mounted namespaces are prefixed with the namespace
+	Name string
+	// default name for template, it is declared in metadata or it is the
+	// name of the template's directory
+	DefaultName string
+	// path to the file
+	Path string
+	// metadata from directory configs, nil if there are no configs
+	DirMetadata *Metadata
+	// permissions of the template's file
+	Mode fs.FileMode
+	// path to the file inside the storage's file system
+	fsPath string
+	// namespace, where the template was mounted, empty for templates from
+	// the storage's directory
+	namespace string
+	// directory of the storage or of the namespace, where the template was
+	// found
+	dir string
+	// name of the directory with the template, empty for the root of the
+	// storage
+	dirName string
+}
+
+func NewTemplateFile(path string, baseDir string) (*TemplateFile, error) {
+	relPath, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, _ := filepath.Split(relPath)
+
+	dirName := ""
+	if parent != "" {
+		dirName = filepath.Base(parent)
+	}
+
+	return &TemplateFile{
+		Name:        filepath.ToSlash(relPath),
+		DefaultName: dirName,
+		Path:        path,
+		dir:         baseDir,
+		dirName:     dirName,
+	}, nil
+}
+
+// matches reports, whether name refers to the template. It is true for
+// the template's name and for any ending of its path, e.g. "LICENSE/mit"
+// and "mit" for "LICENSE/mit". Templates from namespace also match these
+// endings prefixed with the namespace, e.g. "company/mit".
+func (t TemplateFile) matches(name string) bool {
+	suffix := t.fsPath
+	for {
+		if name == suffix || (t.namespace != "" && name == t.namespace+"/"+suffix) {
+			return true
+		}
+		_, rest, found := strings.Cut(suffix, "/")
+		if !found {
+			return false
+		}
+		suffix = rest
+	}
+}
+
+// Namespace returns namespace, where the template was mounted, it is empty
+// for templates from the storage's directory
+func (t TemplateFile) Namespace() string {
+	return t.namespace
+}
+
+// Dir returns directory of the storage or of the namespace, where the
+// template was found
+func (t TemplateFile) Dir() string {
+	return t.dir
+}
+
+func (t TemplateFile) String() string {
+	if t.DefaultName == "" {
+		return t.Name
+	}
+	return t.Name + " - " + t.DefaultName
+}
+
+type Template struct {
+	*TemplateFile
+	Metadata *Metadata
+	// content and tokens are nil, if the template was scanned from a
+	// stream by ScanTemplate
+	Content   []byte
+	Tokens    []Token
+	Variables []string
+	// hash of the template's file
+	Hash string
+	// position of the first usage of every variable
+	positions map[string]Position
+	// sources of paths for variables, which are used only in paths
+	pathSources map[string]string
+	// derived variables and their names in order of computing
+	derived      map[string]derivedVariable
+	derivedOrder []string
+}
+
+func NewTemplate(templateFile *TemplateFile, content []byte) (*Template, error) {
+	template := new(Template)
+
+	// default name can be changed by the header
+	file := *templateFile
+	template.TemplateFile = &file
+
+	header, body := splitMetadata(content)
+	if err := template.setMetadata(header); err != nil {
+		return nil, err
+	}
+
+	template.Content = content
+	template.Hash = contentHash(content)
+	template.Tokens = tokens(body, StartPosition.advance(content[:len(content)-len(body)]), template.Delimiters(), template.Metadata.RawBackslashes)
+	variables, positions, err := template.findVariables(slices.Values(template.Tokens))
+	if err != nil {
+		return nil, err
+	}
+	template.Variables, template.positions = variables, positions
+	template.addDependencies()
+
+	return template, nil
+}
+
+// ScanTemplate reads template's header and variables from the reader
+// without keeping its body in memory, use Render to get the result
+func ScanTemplate(templateFile *TemplateFile, r io.Reader) (*Template, error) {
+	template := new(Template)
+
+	// default name can be changed by the header
+	file := *templateFile
+	template.TemplateFile = &file
+
+	hash := sha256.New()
+	header, body, start, err := readMetadata(io.TeeReader(r, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := template.setMetadata(header); err != nil {
+		return nil, err
+	}
+
+	scanner := NewScanner(body, start, template.Delimiters(), template.Metadata.RawBackslashes)
+	template.Variables, template.positions, err = template.findVariables(scanner.All())
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	template.addDependencies()
+	template.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	return template, nil
+}
+
+func (t *Template) setMetadata(header []byte) error {
+	// first line of the template is a start of the header
+	metadata, err := parseMetadata(t.Path, header, 2)
+	if err != nil {
+		return err
+	}
+
+	// default name from directory configs is already set
+	t.DefaultName = metadata.outputName(t.DefaultName, t.dirName)
+	t.Metadata = metadata.Merge(t.DirMetadata)
+	return t.parseDerived()
+}
+
+// Scan returns scanner for the template's body, r should read the whole
+// template's file
+func (t *Template) Scan(r io.Reader) (*Scanner, error) {
+	_, body, start, err := readMetadata(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewScanner(body, start, t.Delimiters(), t.Metadata.RawBackslashes), nil
+}
+
+// Render writes the template with values to w, r should read the whole
+// template's file. It doesn't keep template's content in memory.
+func (t *Template) Render(w io.Writer, r io.Reader, values map[string]string) error {
+	scanner, err := t.Scan(r)
+	if err != nil {
+		return err
+	}
+
+	for token := range scanner.All() {
+		if err := writeToken(w, token, values); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Fill returns the template with values, it works only for templates read
+// into memory by NewTemplate
+func (t Template) Fill(values map[string]string) string {
+	var sb strings.Builder
+	for _, token := range t.Tokens {
+		// writing into strings.Builder has no errors
+		_ = writeToken(&sb, token, values)
+	}
+	return sb.String()
+}
+
+// UsePath adds variables from the path to the template's variables, so
+// they can be resolved together before ExpandPath. source is the location
+// of variables, which are used only in the path, e.g. "-o posts/{SLUG}.md".
+func (t *Template) UsePath(path, source string) error {
+	pathTokens := tokens([]byte(path), StartPosition, t.Delimiters(), t.Metadata.RawBackslashes)
+	variables, _, err := t.findVariables(slices.Values(pathTokens))
+	if err != nil {
+		return err
+	}
+
+	for _, variable := range variables {
+		if !slices.Contains(t.Variables, variable) {
+			t.Variables = append(t.Variables, variable)
+			if t.pathSources == nil {
+				t.pathSources = make(map[string]string)
+			}
+			t.pathSources[variable] = source
+		}
+	}
+	t.addDependencies()
+	return nil
+}
+
+// ExpandPath returns the path with values of variables, placeholders in
+// the path use the template's delimiters
+func (t *Template) ExpandPath(path string, values map[string]string) string {
+	var sb strings.Builder
+	for _, token := range tokens([]byte(path), StartPosition, t.Delimiters(), t.Metadata.RawBackslashes) {
+		// writing into strings.Builder has no errors
+		_ = writeToken(&sb, token, values)
+	}
+	return sb.String()
+}
+
+// ExpandCommand returns the shell command with values of variables. Values
+// are quoted for sh, so placeholders shouldn't be quoted in the command.
+// Placeholders without values are kept as is, e.g. ${HOME} in the command.
+func (t *Template) ExpandCommand(command string, values map[string]string) string {
+	delimiters := t.Delimiters()
+	var sb strings.Builder
+	for _, token := range tokens([]byte(command), StartPosition, delimiters, t.Metadata.RawBackslashes) {
+		if token.Type != Variable {
+			// writing into strings.Builder has no errors
+			_ = writeToken(&sb, token, values)
+			continue
+		}
+
+		name, filterNames := parsePlaceholder(token.Content)
+		value, ok := values[name]
+		if !ok || checkFilters(filterNames) != nil {
+			sb.Write(delimiters.Open)
+			sb.Write(token.Content)
+			sb.Write(delimiters.Close)
+			continue
+		}
+		sb.WriteString(shellQuote(applyFilters(value, filterNames)))
+	}
+	return sb.String()
+}
+
+// shellQuote returns the value in single quotes, single quotes inside it
+// are closed, escaped and opened again
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// FileMode returns permissions for the generated file. It is the mode from
+// metadata, which should be applied exactly, otherwise the file is
+// executable only if the template is, and umask should be applied to the
+// result like with os.Create.
+func (t *Template) FileMode() fs.FileMode {
+	switch {
+	case t.Metadata.Mode != 0:
+		return t.Metadata.Mode
+	case t.Mode&0o111 != 0:
+		return 0o777
+	}
+	return 0o666
+}
+
+// writeToken writes text or value of the variable, filters of the
+// placeholder should be checked by findVariables
+func writeToken(w io.Writer, token Token, values map[string]string) error {
+	var err error
+	switch {
+	case token.Type == Text || token.Type == Unterminated || token.Type == DanglingEscape:
+		_, err = w.Write(token.Content)
+	case token.Type == Variable && len(token.Content) > 0:
+		name, filterNames := parsePlaceholder(token.Content)
+		val, ok := values[name]
+		if ok {
+			_, err = io.WriteString(w, applyFilters(val, filterNames))
+		}
+	}
+	return err
+}
+
+// Delimiters returns delimiters from metadata or default ones
+func (t *Template) Delimiters() Delimiters {
+	if t.Metadata.Delimiters != nil {
+		return *t.Metadata.Delimiters
+	}
+	return DefaultDelimiters
+}
+
+// Location returns position in the template's file in the form of
+// "path:line:column"
+func (t *Template) Location(pos Position) string {
+	return fmt.Sprintf("%s:%d:%d", t.Path, pos.Line, pos.Column)
+}
+
+// VariablePosition returns position of the first usage of variable
+func (t *Template) VariablePosition(name string) Position {
+	pos, ok := t.positions[name]
+	if !ok {
+		return StartPosition
+	}
+	return pos
+}
+
+// VariableLocation returns location of the first usage of variable, or the
+// source of the path for variables, which are used only in the path
+func (t *Template) VariableLocation(name string) string {
+	if _, ok := t.positions[name]; !ok {
+		if source, ok := t.pathSources[name]; ok {
+			return source
+		}
+	}
+	return t.Location(t.VariablePosition(name))
+}
+
+func (t Template) String() string {
+	return t.TemplateFile.String()
+}
+
+// findVariables returns names of all variables in order of their first
+// appearance and their first positions, it checks filters of placeholders
+// too
+func (t *Template) findVariables(tokens iter.Seq[Token]) ([]string, map[string]Position, error) {
+	var result []string
+	positions := make(map[string]Position)
+
+	for token := range tokens {
+		if token.Type != Variable || len(token.Content) == 0 {
+			continue
+		}
+
+		name, filterNames := parsePlaceholder(token.Content)
+		if err := checkFilters(filterNames); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", t.Location(token.Pos), err)
+		}
+		if _, ok := builtins[name]; strings.HasPrefix(name, BuiltinPrefix) && !ok {
+			return nil, nil, fmt.Errorf("%s: unknown builtin variable %q", t.Location(token.Pos), name)
+		}
+		if _, ok := positions[name]; !ok {
+			positions[name] = token.Pos
+			result = append(result, name)
+		}
+	}
+
+	return result, positions, nil
+}
+
+func contentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,432 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindVariables(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		variables []string
+	}{
+		{
+			name:      "empty string",
+			content:   "",
+			variables: []string{},
+		},
+		{
+			name:      "without variables",
+			content:   "just\nsome text",
+			variables: []string{},
+		},
+		{
+			name:      "single variable",
+			content:   "variable {A}",
+			variables: []string{"A"},
+		},
+		{
+			name:      "same variable twice",
+			content:   "variable {A} and {A}",
+			variables: []string{"A"},
+		},
+		{
+			name:      "empty variable",
+			content:   "just\n\tsome text {} another text",
+			variables: []string{},
+		},
+		{
+			name:      "line break in variable name",
+			content:   "line break {A\n}",
+			variables: []string{},
+		},
+		{
+			name:      "variable escaping",
+			content:   "escaping \\{A} {B}",
+			variables: []string{"B"},
+		},
+		{
+			name:      "escaping without variable",
+			content:   "fake escaping \\[A] {B}",
+			variables: []string{"B"},
+		},
+		{
+			name:      "few variables",
+			content:   "one {A}, two{A B}, three {A B C}",
+			variables: []string{"A", "A B", "A B C"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !slices.Equal(template.Variables, tt.variables) {
+				t.Fatalf("We should get %#v, but got %#v", tt.variables, template.Variables)
+			}
+		})
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		result  string
+		values  map[string]string
+	}{
+		{
+			name:    "without variables",
+			content: "Test\ntest",
+			result:  "Test\ntest",
+			values:  map[string]string{},
+		},
+		{
+			name:    "empty variable",
+			content: "Test {A}",
+			result:  "Test ",
+			values:  map[string]string{},
+		},
+		{
+			name:    "empty variable with values",
+			content: "Test {C}",
+			result:  "Test ",
+			values: map[string]string{
+				"A": "A",
+				"B": "B",
+			},
+		},
+		{
+			name:    "one variable",
+			content: "Test {A}",
+			result:  "Test Var",
+			values: map[string]string{
+				"A": "Var",
+			},
+		},
+		{
+			name:    "one variable and some text",
+			content: "Test {A} another text",
+			result:  "Test Var another text",
+			values: map[string]string{
+				"A": "Var",
+			},
+		},
+		{
+			name:    "two variables",
+			content: "Test {A} rest {B}",
+			result:  "Test 1 rest 2\n3",
+			values: map[string]string{
+				"A": "1",
+				"B": "2\n3",
+			},
+		},
+		{
+			name:    "new line in a name",
+			content: "Test {A\n} rest {B} and {B C}",
+			result:  "Test {A\n} rest SOME TEXT and ANOTHER TEXT",
+			values: map[string]string{
+				"A":   "WITHOUT",
+				"B":   "SOME TEXT",
+				"B C": "ANOTHER TEXT",
+			},
+		},
+		{
+			name:    "some variables are empty",
+			content: "Test {A} rest {B}!",
+			result:  "Test  rest SOME TEXT!",
+			values: map[string]string{
+				"B": "SOME TEXT",
+			},
+		},
+		{
+			name:    "variable escaping",
+			content: "Test \\{A} rest {B}!",
+			result:  "Test {A} rest SOME TEXT!",
+			values: map[string]string{
+				"A": "WITHOUT",
+				"B": "SOME TEXT",
+			},
+		},
+		{
+			name:    "custom delimiters",
+			content: "--- sttemp\ndelimiters: {{ }}\n---\n{\"a\": {{A}}, \"b\": {B}}",
+			result:  "{\"a\": Var, \"b\": {B}}",
+			values: map[string]string{
+				"A": "Var",
+				"B": "WITHOUT",
+			},
+		},
+		{
+			name:    "same opening and closing delimiters",
+			content: "--- sttemp\ndelimiters: @@ @@\n---\n${HOME} @@A@@ @@B@@",
+			result:  "${HOME} 1 2",
+			values: map[string]string{
+				"A": "1",
+				"B": "2",
+			},
+		},
+		{
+			name:    "custom escape",
+			content: "--- sttemp\ndelimiters: <% %> %%\n---\n%%<%A%> <%A%> \\<%A%>",
+			result:  "<%A%> Var \\Var",
+			values: map[string]string{
+				"A": "Var",
+			},
+		},
+		{
+			name:    "unterminated custom delimiter",
+			content: "--- sttemp\ndelimiters: <% %>\n---\n<%A\n<%A%>",
+			result:  "<%A\nVar",
+			values: map[string]string{
+				"A": "Var",
+			},
+		},
+		{
+			name:    "escaping without variable",
+			content: "Test \\[A] rest {B}!",
+			result:  "Test \\[A] rest SOME TEXT!",
+			values: map[string]string{
+				"A": "WITHOUT",
+				"B": "SOME TEXT",
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			result := template.Fill(tt.values)
+			if result != tt.result {
+				t.Fatalf("We should get %#v, but got %#v", tt.result, result)
+			}
+
+			var sb strings.Builder
+			streamTemplate, err := ScanTemplate(&TemplateFile{}, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if err := streamTemplate.Render(&sb, strings.NewReader(tt.content), tt.values); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if sb.String() != tt.result {
+				t.Fatalf("Streaming render should get %#v, but got %#v", tt.result, sb.String())
+			}
+			if !slices.Equal(streamTemplate.Variables, template.Variables) || streamTemplate.Hash != template.Hash {
+				t.Fatalf("Streaming template should be the same as %#v, but got %#v", template, streamTemplate)
+			}
+		})
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		positions []Position
+	}{
+		{
+			name:      "empty string",
+			content:   "",
+			positions: []Position{},
+		},
+		{
+			name:    "variables on different lines",
+			content: "Hello, {NAME}!\n{GREETING}",
+			positions: []Position{
+				{0, 1, 1},
+				{7, 1, 8},
+				{13, 1, 14},
+				{15, 2, 1},
+			},
+		},
+		{
+			name:    "escaped bracket",
+			content: "\\{A} {B}",
+			positions: []Position{
+				{1, 1, 2},
+				{5, 1, 6},
+			},
+		},
+		{
+			name:    "unterminated variable",
+			content: "{A\n{B}",
+			positions: []Position{
+				{0, 1, 1},
+				{2, 1, 3},
+				{3, 2, 1},
+			},
+		},
+		{
+			name:    "after header",
+			content: "--- sttemp\ndescription: test\n---\nHello, {NAME}",
+			positions: []Position{
+				{33, 4, 1},
+				{40, 4, 8},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			positions := make([]Position, 0, len(template.Tokens))
+			for _, token := range template.Tokens {
+				positions = append(positions, token.Pos)
+			}
+			if !slices.Equal(positions, tt.positions) {
+				t.Fatalf("We should get %v, but got %v", tt.positions, positions)
+			}
+		})
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		result    string
+		rawResult string
+	}{
+		{
+			name:      "escaped opening delimiter",
+			content:   "\\{A}",
+			result:    "{A}",
+			rawResult: "{A}",
+		},
+		{
+			name:      "escaped closing delimiter",
+			content:   "\\} {A}",
+			result:    "} 1",
+			rawResult: "\\} 1",
+		},
+		{
+			name:      "escaped backslash",
+			content:   "\\\\",
+			result:    "\\",
+			rawResult: "\\\\",
+		},
+		{
+			name:      "escaped backslash before variable",
+			content:   "\\\\{A}",
+			result:    "\\1",
+			rawResult: "\\\\1",
+		},
+		{
+			name:      "escaped backslash before escaped bracket",
+			content:   "\\\\\\{A}",
+			result:    "\\{A}",
+			rawResult: "\\\\{A}",
+		},
+		{
+			name:      "windows path",
+			content:   "C:\\path\\{A}",
+			result:    "C:\\path{A}",
+			rawResult: "C:\\path{A}",
+		},
+		{
+			name:      "latex and shell",
+			content:   "\\section{A} echo \"\\n\"",
+			result:    "\\section1 echo \"\\n\"",
+			rawResult: "\\section1 echo \"\\n\"",
+		},
+		{
+			name:      "backslash at the end",
+			content:   "{A}\\",
+			result:    "1\\",
+			rawResult: "1\\",
+		},
+		{
+			name:      "escaped backslash at the end",
+			content:   "{A}\\\\",
+			result:    "1\\",
+			rawResult: "1\\\\",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := NewTemplate(&TemplateFile{}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			result := template.Fill(map[string]string{"A": "1"})
+			if result != tt.result {
+				t.Fatalf("We should get %#v, but got %#v", tt.result, result)
+			}
+
+			rawTemplate, err := NewTemplate(&TemplateFile{DirMetadata: &Metadata{RawBackslashes: true}}, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			rawResult := rawTemplate.Fill(map[string]string{"A": "1"})
+			if rawResult != tt.rawResult {
+				t.Fatalf("In raw mode we should get %#v, but got %#v", tt.rawResult, rawResult)
+			}
+		})
+	}
+}
+
+func TestRenderLargeTemplate(t *testing.T) {
+	line := "INSERT INTO users VALUES ('{NAME}', '\\{escaped}');\n"
+	content := strings.Repeat(line, 10_000)
+	expect := strings.Repeat("INSERT INTO users VALUES ('Alice', '{escaped}');\n", 10_000)
+
+	template, err := ScanTemplate(&TemplateFile{}, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !slices.Equal(template.Variables, []string{"NAME"}) {
+		t.Fatalf("We should get [NAME], but got %#v", template.Variables)
+	}
+
+	var result bytes.Buffer
+	if err := template.Render(&result, strings.NewReader(content), map[string]string{"NAME": "Alice"}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if result.String() != expect {
+		t.Fatalf("wrong result of the large template rendering")
+	}
+}
+
+// benchmarkContent is a few megabytes of SQL with placeholders
+var benchmarkContent = strings.Repeat("INSERT INTO users (name, email) VALUES ('{NAME}', '{EMAIL}'); -- some comment\n", 50_000)
+
+var benchmarkValues = map[string]string{"NAME": "Alice", "EMAIL": "alice@example.com"}
+
+func BenchmarkFillTemplate(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		template, err := NewTemplate(&TemplateFile{}, []byte(benchmarkContent))
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.WriteString(io.Discard, template.Fill(benchmarkValues))
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		template, err := ScanTemplate(&TemplateFile{}, strings.NewReader(benchmarkContent))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := template.Render(io.Discard, strings.NewReader(benchmarkContent), benchmarkValues); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// HookEnvPrefix starts names of environment variables with values for
+// hooks, when --env-prefix is not set, so values never replace variables
+// like PATH or HOME
+const HookEnvPrefix = "STTEMP_"
+
+// OutputVariable is a placeholder in hooks with the path of the generated
+// file, it is set in environment of hooks with the prefix too
+const OutputVariable = "OUTPUT"
+
+// allowCommands reports, whether commands of the template can be run:
+// hooks, values commands, secret commands and command placeholders.
+// Commands of templates from packs are run only after user's confirmation.
+func (cs *CliState) allowCommands(template *engine.Template, commands []string) (bool, error) {
+	if len(commands) == 0 {
+		return false, nil
+	}
+
+	namespace := template.Namespace()
+	if namespace == "" {
+		return true, nil
+	}
+
+	if cs.noInput {
+		fmt.Fprintf(cs.ioh.Stderr, "commands of %s are skipped, because they are from pack %s and --no-input is set\n", template.Name, namespace)
+		return false, nil
+	}
+
+	fmt.Fprintf(cs.ioh.Stderr, "template %s from pack %s runs commands:\n", template.Name, namespace)
+	for _, command := range commands {
+		fmt.Fprintf(cs.ioh.Stderr, "  %s\n", command)
+	}
+	return cs.ioh.confirm("Run them?")
+}
+
+// commandPlaceholders returns commands from {!command} placeholders of the
+// template, they are run only with --allow-exec
+func (cs *CliState) commandPlaceholders(template *engine.Template) []string {
+	if !cs.allowExec {
+		return nil
+	}
+	var commands []string
+	for _, name := range template.Variables {
+		if command, ok := engine.Command(name); ok {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// runHooks runs template's hooks with sh one by one, and stops on the first
+// failed hook. Placeholders in hooks are replaced with quoted values, and
+// values are set in environment with the prefix, e.g. $STTEMP_MODULE.
+func (cs *CliState) runHooks(template *engine.Template, output string, values map[string]string) error {
+	values = withoutCommands(values)
+	values[OutputVariable] = output
+
+	hookIOH := *cs.ioh
+	hookIOH.Env = []string{}
+	prefix := cmp.Or(cs.envPrefix, HookEnvPrefix)
+	names := append([]string{OutputVariable}, slices.Sorted(maps.Keys(values))...)
+	for _, name := range names {
+		env := envName(prefix, name)
+		// existing variables are never replaced
+		if _, ok := cs.ioh.LookupEnv(env); ok || slices.ContainsFunc(hookIOH.Env, func(entry string) bool {
+			return strings.HasPrefix(entry, env+"=")
+		}) {
+			continue
+		}
+		hookIOH.Env = append(hookIOH.Env, env+"="+values[name])
+	}
+
+	for _, hook := range template.Metadata.Hooks {
+		fmt.Fprintf(cs.ioh.Stderr, "running %s\n", hook)
+		if err := cs.ioh.CommandRunner.Run(&hookIOH, "sh", "-c", template.ExpandCommand(hook, values)); err != nil {
+			return fmt.Errorf("hook %q of %s: %w", hook, template.Name, err)
+		}
+	}
+	return nil
+}
+
+// computeValues runs values commands of the template, values of later
+// commands override earlier ones
+func (cs *CliState) computeValues(template *engine.Template) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, command := range template.Metadata.ValuesCommands {
+		output, err := cs.ioh.captureCommand("sh", "-c", command)
+		if err != nil {
+			return nil, fmt.Errorf("values command %q of %s: %w", command, template.Name, err)
+		}
+
+		commandValues, err := parseValues(output)
+		if err != nil {
+			return nil, fmt.Errorf("values command %q of %s: %w", command, template.Name, err)
+		}
+		maps.Copy(values, commandValues)
+	}
+	return values, nil
+}
+
+// parseValues parses output of values command, it is a JSON object or
+// KEY=VALUE lines. Empty lines and lines started with # are ignored.
+func parseValues(output []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	if trimmed := bytes.TrimSpace(output); bytes.HasPrefix(trimmed, []byte("{")) {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &object); err != nil {
+			return nil, err
+		}
+		for key, raw := range object {
+			// strings are unquoted, numbers and others are used as is
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				value = string(raw)
+			}
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	for line := range strings.Lines(string(output)) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("expected KEY=VALUE, but got %q", line)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
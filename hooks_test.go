@@ -0,0 +1,54 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseValues(t *testing.T) {
+	testCases := []struct {
+		name    string
+		output  string
+		expect  map[string]string
+		wantErr string
+	}{
+		{
+			name:   "lines",
+			output: "# comment\nMODULE PATH=example.com/app\n\nARGS=a=b \n",
+			expect: map[string]string{"MODULE PATH": "example.com/app", "ARGS": "a=b "},
+		},
+		{
+			name:   "json",
+			output: "{\"NAME\": \"app\", \"NUMBER\": 7, \"DOCKER\": true}\n",
+			expect: map[string]string{"NAME": "app", "NUMBER": "7", "DOCKER": "true"},
+		},
+		{
+			name:   "empty output",
+			output: "",
+			expect: map[string]string{},
+		},
+		{
+			name:    "wrong line",
+			output:  "example.com/app\n",
+			wantErr: "expected KEY=VALUE, but got \"example.com/app\"",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseValues([]byte(tt.output))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, but got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !maps.Equal(values, tt.expect) {
+				t.Fatalf("expected %v, but got %v", tt.expect, values)
+			}
+		})
+	}
+}
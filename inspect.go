@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// TemplateInfo is a machine-readable description of the template
+type TemplateInfo struct {
+	Name        string         `json:"name"`
+	Namespace   string         `json:"namespace,omitempty"`
+	DefaultName string         `json:"default_name"`
+	Path        string         `json:"path"`
+	Dir         string         `json:"dir"`
+	Description string         `json:"description"`
+	Variables   []VariableInfo `json:"variables"`
+	Hooks       []string       `json:"hooks,omitempty"`
+	// commands from {!command} placeholders
+	Commands []string `json:"commands,omitempty"`
+}
+
+type VariableInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default"`
+	// value of derived variable
+	Value string `json:"value,omitempty"`
+	Label string `json:"label,omitempty"`
+	Help  string `json:"help,omitempty"`
+	// variable is asked only if this variable is yes
+	If string `json:"if,omitempty"`
+	// value isn't echoed and isn't saved in the answers file
+	Secret        bool   `json:"secret,omitempty"`
+	SecretFile    string `json:"secret_file,omitempty"`
+	SecretCommand string `json:"secret_command,omitempty"`
+}
+
+// status of the variable value before rendering
+const (
+	StatusEnv      = "env"
+	StatusDefault  = "default"
+	StatusMissing  = "missing"
+	StatusDerived  = "derived"
+	StatusBuiltin  = "builtin"
+	StatusComputed = "computed"
+	StatusSecret   = "secret"
+)
+
+// VariableStatus shows, where the value of the variable will come from
+type VariableStatus struct {
+	VariableInfo
+	Status string `json:"status"`
+}
+
+func NewTemplateInfo(template *engine.Template) TemplateInfo {
+	variables := make([]VariableInfo, 0, len(template.Variables))
+	var commands []string
+	for _, variable := range template.Variables {
+		if command, ok := engine.Command(variable); ok {
+			commands = append(commands, command)
+			continue
+		}
+
+		metadata := template.Metadata.Variable(variable)
+		// defaults of secrets are never printed, like in prompts
+		if metadata.Secret && metadata.Default != "" {
+			metadata.Default = SecretMask
+		}
+		variables = append(variables, VariableInfo{
+			Name:          variable,
+			Description:   metadata.Description,
+			Default:       metadata.Default,
+			Value:         metadata.Value,
+			Label:         metadata.Label,
+			Help:          metadata.Help,
+			If:            metadata.If,
+			Secret:        metadata.Secret,
+			SecretFile:    metadata.SecretFile,
+			SecretCommand: metadata.SecretCommand,
+		})
+	}
+
+	return TemplateInfo{
+		Name:        template.Name,
+		Namespace:   template.Namespace(),
+		DefaultName: template.DefaultName,
+		Path:        template.Path,
+		Dir:         template.Dir(),
+		Description: template.Metadata.Description,
+		Variables:   variables,
+		Hooks:       template.Metadata.Hooks,
+		Commands:    commands,
+	}
+}
+
+func (ti TemplateInfo) writeText(w io.Writer) {
+	fmt.Fprintf(w, "name: %s\n", ti.Name)
+	if ti.Namespace != "" {
+		fmt.Fprintf(w, "pack: %s\n", ti.Namespace)
+	}
+	if ti.DefaultName != "" {
+		fmt.Fprintf(w, "default name: %s\n", ti.DefaultName)
+	}
+	fmt.Fprintf(w, "path: %s\n", ti.Path)
+	if ti.Description != "" {
+		fmt.Fprintf(w, "description: %s\n", ti.Description)
+	}
+	if len(ti.Hooks) > 0 {
+		fmt.Fprintln(w, "hooks:")
+		for _, hook := range ti.Hooks {
+			fmt.Fprintf(w, "  %s\n", hook)
+		}
+	}
+	if len(ti.Commands) > 0 {
+		fmt.Fprintln(w, "commands:")
+		for _, command := range ti.Commands {
+			fmt.Fprintf(w, "  %s\n", command)
+		}
+	}
+	if len(ti.Variables) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "variables:")
+	for _, variable := range ti.Variables {
+		fmt.Fprintf(w, "  %s", variable.Name)
+		if variable.Default != "" {
+			fmt.Fprintf(w, " [%s]", variable.Default)
+		}
+		if variable.Value != "" {
+			fmt.Fprintf(w, " = %s", variable.Value)
+		}
+		if variable.Secret {
+			fmt.Fprint(w, " (secret)")
+		}
+		if variable.Description != "" {
+			fmt.Fprintf(w, " - %s", variable.Description)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// NewVariableStatuses returns statuses of template's variables, computed
+// are values from values commands of the template, secret commands are
+// counted only if they can be run
+func NewVariableStatuses(info TemplateInfo, lookupEnv func(key string) (string, bool), computed map[string]string, allowSecretCommands bool) []VariableStatus {
+	statuses := make([]VariableStatus, 0, len(info.Variables))
+	for _, variable := range info.Variables {
+		_, inEnv := lookupEnv(variable.Name)
+		_, isComputed := computed[variable.Name]
+		fromSecret := variable.SecretFile != "" || (variable.SecretCommand != "" && allowSecretCommands)
+		status := StatusMissing
+		switch {
+		case variable.Value != "":
+			status = StatusDerived
+		case strings.HasPrefix(variable.Name, engine.BuiltinPrefix):
+			status = StatusBuiltin
+		case inEnv:
+			status = StatusEnv
+		case fromSecret:
+			status = StatusSecret
+		case isComputed:
+			status = StatusComputed
+		case variable.Default != "":
+			status = StatusDefault
+		}
+		statuses = append(statuses, VariableStatus{variable, status})
+	}
+	return statuses
+}
+
+func writeVariableStatuses(w io.Writer, statuses []VariableStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tSTATUS\tDEFAULT\tDESCRIPTION")
+	for _, status := range statuses {
+		// value of conditional variable is needed only if the condition
+		// is met
+		statusText := status.Status
+		if status.If != "" {
+			statusText += " if " + status.If
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status.Name, statusText, status.Default, status.Description)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
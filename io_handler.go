@@ -2,13 +2,17 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+
+	"github.com/konyahin/sttemp/engine"
 )
 
 type CommandRunner interface {
@@ -22,19 +26,41 @@ func (r *RealCommandRunner) Run(ioh *IOHandler, name string, args ...string) err
 	cmd.Stdin = ioh.Stdin
 	cmd.Stdout = ioh.Stdout
 	cmd.Stderr = ioh.Stderr
+	if ioh.Env != nil {
+		cmd.Env = append(os.Environ(), ioh.Env...)
+	}
 	return cmd.Run()
 }
 
+// captureCommand runs the command and returns its stdout, stderr is not
+// captured
+func (ioh *IOHandler) captureCommand(name string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	captured := *ioh
+	captured.Stdout = &stdout
+	err := ioh.CommandRunner.Run(&captured, name, args...)
+	return stdout.Bytes(), err
+}
+
 type IOHandler struct {
-	Stdin         io.Reader
-	Stdout        io.Writer
-	Stderr        io.Writer
-	LookupEnv     func(key string) (string, bool)
-	ReadFile      func(name string) ([]byte, error)
-	UserHomeDir   func() (string, error)
-	WalkDir       func(root string, fn fs.WalkDirFunc) error
-	Create        func(name string) (OutputFile, error)
+	Stdin       io.Reader
+	Stdout      io.Writer
+	Stderr      io.Writer
+	LookupEnv   func(key string) (string, bool)
+	ReadFile    func(name string) ([]byte, error)
+	UserHomeDir func() (string, error)
+	DirFS       func(dir string) fs.FS
+	// perm is used only for new files, umask is applied to it
+	Create        func(name string, perm fs.FileMode) (OutputFile, error)
+	Chmod         func(name string, mode fs.FileMode) error
+	Stat          func(name string) (fs.FileInfo, error)
+	Mkdir         func(name string, perm fs.FileMode) error
+	RemoveAll     func(path string) error
 	CommandRunner CommandRunner
+	// additional environment variables for commands
+	Env []string
+	// group of the last asked variable
+	group string
 }
 
 func DefaultIOHandler() *IOHandler {
@@ -45,44 +71,150 @@ func DefaultIOHandler() *IOHandler {
 		LookupEnv:   os.LookupEnv,
 		ReadFile:    os.ReadFile,
 		UserHomeDir: os.UserHomeDir,
-		WalkDir:     filepath.WalkDir,
-		Create: func(name string) (OutputFile, error) {
-			file, err := os.Create(name)
+		DirFS:       os.DirFS,
+		Create: func(name string, perm fs.FileMode) (OutputFile, error) {
+			file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 			return OutputFile(file), err
 		},
+		Chmod:         os.Chmod,
+		Stat:          os.Stat,
+		Mkdir:         os.Mkdir,
+		RemoveAll:     os.RemoveAll,
 		CommandRunner: &RealCommandRunner{},
 	}
 }
 
-func (ioh *IOHandler) askForValue(variable string) (string, error) {
+func (ioh *IOHandler) askForValue(variable engine.VariableMetadata) (string, error) {
+	if variable.Group != ioh.group && variable.Group != "" {
+		fmt.Fprintf(ioh.Stderr, "%s:\n", variable.Group)
+	}
+	ioh.group = variable.Group
+
+	prompt := "Enter value for " + cmp.Or(variable.Label, variable.Name)
+	switch {
+	case variable.Default != "" && variable.Secret:
+		prompt += " [" + SecretMask + "]"
+	case variable.Default != "":
+		prompt += " [" + variable.Default + "]"
+	}
+	if variable.Help != "" {
+		prompt += " (? for help)"
+	}
+
+	if variable.Secret {
+		defer ioh.disableEcho()()
+	}
+
 	reader := bufio.NewReader(ioh.Stdin)
-	fmt.Fprintf(ioh.Stderr, "Enter value for %s: ", variable)
+	for {
+		fmt.Fprintf(ioh.Stderr, "%s: ", prompt)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		value := strings.TrimRight(input, "\n")
+		if value == "?" && variable.Help != "" {
+			fmt.Fprintln(ioh.Stderr, variable.Help)
+			continue
+		}
+		if value == "" {
+			return variable.Default, nil
+		}
+		return value, nil
+	}
+}
+
+// disableEcho turns off echo of the terminal with stty and returns function,
+// which turns it on again. Nothing is changed, if stdin is not a terminal.
+func (ioh *IOHandler) disableEcho() func() {
+	stty := *ioh
+	stty.Stdout, stty.Stderr = io.Discard, io.Discard
+	if err := ioh.CommandRunner.Run(&stty, "stty", "-echo"); err != nil {
+		return func() {}
+	}
+	return func() {
+		_ = ioh.CommandRunner.Run(&stty, "stty", "echo")
+		// new line after the input isn't echoed too
+		fmt.Fprintln(ioh.Stderr)
+	}
+}
+
+// confirm asks user a question, which can be answered with yes or no, no is
+// the default answer
+func (ioh *IOHandler) confirm(question string) (bool, error) {
+	fmt.Fprintf(ioh.Stderr, "%s [y/N]: ", question)
 
+	reader := bufio.NewReader(ioh.Stdin)
 	input, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
 	}
 
-	return strings.TrimRight(input, "\n"), nil
+	answer := strings.ToLower(strings.TrimSpace(input))
+	return answer == "y" || answer == "yes", nil
 }
 
-func (ioh *IOHandler) getVariableValues(template *Template, noInput bool) (map[string]string, error) {
-	values := make(map[string]string, len(template.Variables))
-	for _, variable := range template.Variables {
-		envValue, ok := ioh.LookupEnv(variable)
-		if !ok && noInput {
-			return nil, fmt.Errorf("variable %s is not set and --no-input is enabled; set %s in environment", variable, variable)
-		}
-		if !ok {
-			var err error
-			envValue, err = ioh.askForValue(variable)
-			if err != nil {
-				return nil, err
-			}
+// noInputError is returned, when --no-input is enabled and some variables
+// have no values
+type noInputError struct {
+	*engine.MissingVariablesError
+	// returns name of the environment variable, nil if environment is
+	// not used
+	envName func(name string) string
+}
+
+func (e *noInputError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("variables are not set and --no-input is enabled")
+	if e.envName != nil {
+		sb.WriteString("; set them in environment")
+	}
+	sb.WriteString(":")
+	for _, missing := range e.Variables {
+		fmt.Fprintf(&sb, "\n  %s: %s", missing.Location, missing.Name)
+		if e.envName != nil && e.envName(missing.Name) != missing.Name {
+			fmt.Fprintf(&sb, " (%s)", e.envName(missing.Name))
 		}
-		values[variable] = envValue
 	}
-	return values, nil
+	return sb.String()
+}
+
+func (e *noInputError) Unwrap() error {
+	return e.MissingVariablesError
+}
+
+// envName returns name of the environment variable with the value of the
+// variable: the name in upper case with underscores instead of spaces after
+// the prefix, e.g. STTEMP_FIRST_NAME for "first name"
+func envName(prefix string, name string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+}
+
+// resolver returns values from environment, computed values, defaults and
+// user's input. With --no-input, variables without environment values,
+// computed values and defaults are missing.
+func (ioh *IOHandler) resolver(lookupEnv func(name string) (string, bool), noInput bool, computed map[string]string) engine.Resolver {
+	return func(variable engine.VariableMetadata) (string, error) {
+		return ioh.getVariableValue(variable, lookupEnv, noInput, computed)
+	}
+}
+
+func (ioh *IOHandler) getVariableValue(variable engine.VariableMetadata, lookupEnv func(name string) (string, bool), noInput bool, computed map[string]string) (string, error) {
+	envValue, ok := lookupEnv(variable.Name)
+	if ok {
+		return envValue, nil
+	}
+	if value, ok := computed[variable.Name]; ok {
+		return value, nil
+	}
+	if noInput && variable.Default != "" {
+		return variable.Default, nil
+	}
+	if noInput {
+		return "", fmt.Errorf("%w: %s", engine.ErrMissingVariable, variable.Name)
+	}
+	return ioh.askForValue(variable)
 }
 
 func (ioh *IOHandler) executeCommand(command string, arg string) error {
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/konyahin/sttemp/engine"
 )
 
 func TestAskForValueStderrOutput(t *testing.T) {
@@ -15,7 +18,7 @@ func TestAskForValueStderrOutput(t *testing.T) {
 		Stderr: &writer,
 	}
 
-	_, _ = ioh.askForValue("VAR")
+	_, _ = ioh.askForValue(engine.VariableMetadata{Name: "VAR"})
 
 	value := writer.String()
 	expect := "Enter value for VAR: "
@@ -27,26 +30,38 @@ func TestAskForValueStderrOutput(t *testing.T) {
 func TestAskForValue(t *testing.T) {
 	testCases := []struct {
 		name      string
-		variable  string
+		variable  engine.VariableMetadata
 		input     string
 		expect    string
 		expectErr error
 	}{
 		{
 			name:     "happy path",
-			variable: "VAR",
+			variable: engine.VariableMetadata{Name: "VAR"},
 			input:    "VALUE\n",
 			expect:   "VALUE",
 		},
 		{
 			name:     "no trim for whitespaces",
-			variable: "VAR",
+			variable: engine.VariableMetadata{Name: "VAR"},
 			input:    " VALUE \n",
 			expect:   " VALUE ",
 		},
+		{
+			name:     "empty input with default value",
+			variable: engine.VariableMetadata{Name: "VAR", Default: "DEFAULT"},
+			input:    "\n",
+			expect:   "DEFAULT",
+		},
+		{
+			name:     "default value can be overridden",
+			variable: engine.VariableMetadata{Name: "VAR", Default: "DEFAULT"},
+			input:    "VALUE\n",
+			expect:   "VALUE",
+		},
 		{
 			name:      "user cancel input",
-			variable:  "VAR",
+			variable:  engine.VariableMetadata{Name: "VAR"},
 			input:     " VALUE ",
 			expectErr: io.EOF,
 		},
@@ -72,3 +87,58 @@ func TestAskForValue(t *testing.T) {
 		})
 	}
 }
+
+func TestAskForValueLabelAndHelp(t *testing.T) {
+	var writer bytes.Buffer
+	ioh := &IOHandler{
+		Stdin:  strings.NewReader("?\nAlice\n"),
+		Stderr: &writer,
+	}
+
+	variable := engine.VariableMetadata{
+		Name:    "FIRST_NAME",
+		Label:   "First name",
+		Help:    "Name of the copyright holder",
+		Default: "Bob",
+	}
+	value, err := ioh.askForValue(variable)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if value != "Alice" {
+		t.Fatalf("expected: Alice,\nbut got: %v.", value)
+	}
+
+	prompt := "Enter value for First name [Bob] (? for help): "
+	expect := prompt + "Name of the copyright holder\n" + prompt
+	if writer.String() != expect {
+		t.Fatalf("expected: %q,\nbut got: %q.", expect, writer.String())
+	}
+}
+
+func TestAskForSecretValue(t *testing.T) {
+	var writer bytes.Buffer
+	runner := &MockCommandRunner{}
+	ioh := &IOHandler{
+		Stdin:         strings.NewReader("\n"),
+		Stderr:        &writer,
+		CommandRunner: runner,
+	}
+
+	value, err := ioh.askForValue(engine.VariableMetadata{Name: "TOKEN", Default: "s3cret", Secret: true})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if value != "s3cret" {
+		t.Fatalf("expected: s3cret,\nbut got: %v.", value)
+	}
+
+	expect := "Enter value for TOKEN [" + SecretMask + "]: \n"
+	if writer.String() != expect {
+		t.Fatalf("expected: %q,\nbut got: %q.", expect, writer.String())
+	}
+	calls := [][]string{{"stty", "-echo"}, {"stty", "echo"}}
+	if !reflect.DeepEqual(runner.Calls, calls) {
+		t.Fatalf("expected commands %q, but got %q", calls, runner.Calls)
+	}
+}
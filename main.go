@@ -1,39 +1,109 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"strconv"
+
+	"github.com/konyahin/sttemp/engine"
 )
 
+// exit code for the case, when --no-input is set and some variables are
+// missing, other errors exit with 1
+const ExitMissingVariables = 3
+
 func main() {
-	path := flag.String("C", "", "template's directory (by default is ~/"+GetDefaultTemplateDir()+")")
+	path := flag.String("C", "", "template's directory or .zip, .tar, .tar.gz archive (by default is ~/"+GetDefaultTemplateDir()+")")
 	outputFileName := flag.String("o", "", "output file name")
 	defaultName := flag.Bool("d", false, "use default name for template")
 	noInput := flag.Bool("no-input", false, "use only environment variables")
 	editMode := flag.Bool("edit", false, "edit selected template in your console editor")
 	listTemplates := flag.Bool("l", false, "list all templates")
+	noRecord := flag.Bool("no-record", false, "do not save used values into "+AnswersFileName)
+	jsonOutput := flag.Bool("json", false, "print templates list or inspect command result as JSON")
+	strict := flag.Bool("strict", false, "do not render templates with malformed placeholders")
+	rawBackslashes := flag.Bool("raw-backslashes", false, "backslash escapes only opening bracket, as in old versions")
+	noMkdir := flag.Bool("no-mkdir", false, "do not create missing directories of output files")
+	dirMode := flag.String("dir-mode", fmt.Sprintf("%o", DefaultDirMode), "permissions of created directories")
+	noHooks := flag.Bool("no-hooks", false, "do not run hooks of templates after generation, values and secret commands are still run")
+	allowExec := flag.Bool("allow-exec", false, "run commands from {!command} placeholders")
+	envPrefix := flag.String("env-prefix", "", "read values only from environment variables with this prefix, e.g. STTEMP_")
+	noEnv := flag.Bool("no-env", false, "do not read values from environment variables")
+	updateMode := flag.Bool("update", false, "render again files from "+AnswersFileName+", if their templates were changed")
+	force := flag.Bool("force", false, "overwrite files, which were changed after generation, with --update")
+
+	args := parseArgs(flag.CommandLine, os.Args[1:])
+	command, templateNames := splitCommand(args)
 
-	flag.Parse()
+	mode, err := strconv.ParseUint(*dirMode, 8, 32)
+	if err != nil {
+		log.Fatalf("wrong -dir-mode %q, it should be octal number like 755", *dirMode)
+	}
 
 	ioh := DefaultIOHandler()
 
-	storage, err := NewStorage(ioh, *path)
+	storage, readOnly, err := openStorage(ioh, *path)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	runState := CliState{
-		*outputFileName,
-		*defaultName,
-		flag.Args(),
-		storage,
-		*noInput,
-		ioh,
-		*editMode,
-		*listTemplates,
+		outputFileName: *outputFileName,
+		defaultName:    *defaultName,
+		templateNames:  templateNames,
+		storage:        storage,
+		readOnly:       readOnly,
+		noInput:        *noInput,
+		ioh:            ioh,
+		editMode:       *editMode,
+		listTemplates:  *listTemplates,
+		noRecord:       *noRecord,
+		updateMode:     *updateMode,
+		force:          *force,
+		command:        command,
+		jsonOutput:     *jsonOutput,
+		strict:         *strict,
+		rawBackslashes: *rawBackslashes,
+		noMkdir:        *noMkdir,
+		noHooks:        *noHooks,
+		allowExec:      *allowExec,
+		envPrefix:      *envPrefix,
+		noEnv:          *noEnv,
+		dirMode:        fs.FileMode(mode),
 	}
 
 	if err := runState.Run(); err != nil {
+		if errors.Is(err, engine.ErrMissingVariable) {
+			log.Print(err)
+			os.Exit(ExitMissingVariables)
+		}
 		log.Fatal(err)
 	}
 }
+
+// parseArgs parses flags, which can be placed between positional arguments,
+// and returns positional arguments
+func parseArgs(flagSet *flag.FlagSet, args []string) []string {
+	var positional []string
+	for len(args) > 0 {
+		// flag set exits on error by default
+		flagSet.Parse(args)
+		rest := flagSet.Args()
+
+		// everything after "--" is positional
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...)
+		}
+
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return positional
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// PacksDir is a directory inside the storage, where packs are cloned. It is
+// hidden, so templates from packs are found only with their namespace.
+const PacksDir = ".packs"
+
+// PacksLockName is a file in PacksDir with installed packs
+const PacksLockName = "packs.lock"
+
+// subcommands of the pack command
+const (
+	PackAdd    = "add"
+	PackUpdate = "update"
+	PackRemove = "remove"
+)
+
+// PacksLock keeps sources and revisions of all installed packs
+type PacksLock struct {
+	Packs []Pack `json:"packs"`
+}
+
+// Pack is a git repository with templates, its templates are available as
+// "name/template"
+type Pack struct {
+	Name string `json:"name"`
+	// url or path of the git repository
+	Source string `json:"source"`
+	// commit, which is checked out
+	Revision string `json:"revision"`
+}
+
+func (p *PacksLock) find(name string) int {
+	return slices.IndexFunc(p.Packs, func(pack Pack) bool {
+		return pack.Name == name
+	})
+}
+
+// readPacksLock reads lockfile from the storage's file system, no lockfile
+// means no packs
+func readPacksLock(fsys fs.FS) (*PacksLock, error) {
+	content, err := fs.ReadFile(fsys, path.Join(PacksDir, PacksLockName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &PacksLock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := new(PacksLock)
+	if err := json.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", PacksLockName, err)
+	}
+	return lock, nil
+}
+
+func (p *PacksLock) save(ioh *IOHandler, dir string) error {
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// there is no directory before the first pack is added
+	if err := ioh.Mkdir(filepath.Join(dir, PacksDir), DefaultDirMode); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	file, err := ioh.Create(filepath.Join(dir, PacksDir, PacksLockName), DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// mountPacks adds templates of all installed packs into the storage. Broken
+// or missing packs are skipped with a warning, so they can still be updated
+// or removed.
+func mountPacks(storage *engine.Storage, fsys fs.FS, warnings io.Writer) error {
+	lock, err := readPacksLock(fsys)
+	if err != nil {
+		return err
+	}
+
+	for _, pack := range lock.Packs {
+		packFS, err := fs.Sub(fsys, path.Join(PacksDir, pack.Name))
+		if err == nil {
+			err = storage.Mount(pack.Name, packFS, filepath.Join(storage.Dir(), PacksDir, pack.Name))
+		}
+		if err != nil {
+			fmt.Fprintf(warnings, "pack %s is skipped: %v\n", pack.Name, err)
+		}
+	}
+	return nil
+}
+
+// packName returns the last element of the source without .git suffix
+func packName(source string) string {
+	source = strings.TrimRight(source, "/")
+	name := source[strings.LastIndexAny(source, "/:")+1:]
+	return strings.TrimSuffix(name, ".git")
+}
+
+func validatePackName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid pack name %q", name)
+	}
+	return nil
+}
+
+// pack installs, updates and removes packs, args are pack subcommand and its
+// arguments
+func (cs *CliState) pack(args []string) error {
+	if cs.readOnly {
+		return fmt.Errorf("packs can't be installed into %s", cs.storage.Dir())
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("pack command needs one of subcommands: %s, %s, %s", PackAdd, PackUpdate, PackRemove)
+	}
+
+	lock, err := readPacksLock(cs.ioh.DirFS(cs.storage.Dir()))
+	if err != nil {
+		return err
+	}
+
+	subcommand, args := args[0], args[1:]
+	switch subcommand {
+	case PackAdd:
+		err = cs.packAdd(lock, args)
+	case PackUpdate:
+		err = cs.packUpdate(lock, args)
+	case PackRemove:
+		err = cs.packRemove(lock, args)
+	default:
+		return fmt.Errorf("unknown pack subcommand %s", subcommand)
+	}
+	if err != nil {
+		return err
+	}
+
+	return lock.save(cs.ioh, cs.storage.Dir())
+}
+
+// packAdd clones the repository, args are source and optional name of the
+// pack
+func (cs *CliState) packAdd(lock *PacksLock, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("pack %s needs git repository and optional pack name", PackAdd)
+	}
+
+	source := args[0]
+	name := packName(source)
+	if len(args) == 2 {
+		name = args[1]
+	}
+	if err := validatePackName(name); err != nil {
+		return err
+	}
+	if lock.find(name) != -1 {
+		return fmt.Errorf("pack %s is already installed", name)
+	}
+
+	dir := cs.packDir(name)
+	if err := cs.ioh.CommandRunner.Run(cs.ioh, "git", "clone", "--quiet", source, dir); err != nil {
+		return fmt.Errorf("can't clone %s: %w", source, err)
+	}
+
+	revision, err := cs.packRevision(dir)
+	if err != nil {
+		return err
+	}
+
+	lock.Packs = append(lock.Packs, Pack{name, source, revision})
+	fmt.Fprintf(cs.ioh.Stderr, "pack %s is installed at %s\n", name, revision)
+	return nil
+}
+
+// packUpdate pulls changes for selected packs or for all of them
+func (cs *CliState) packUpdate(lock *PacksLock, names []string) error {
+	if len(names) == 0 {
+		for _, pack := range lock.Packs {
+			names = append(names, pack.Name)
+		}
+	}
+
+	for _, name := range names {
+		idx := lock.find(name)
+		if idx == -1 {
+			return fmt.Errorf("pack %s is not installed", name)
+		}
+
+		dir := cs.packDir(name)
+		if err := cs.ioh.CommandRunner.Run(cs.ioh, "git", "-C", dir, "pull", "--quiet", "--ff-only"); err != nil {
+			return fmt.Errorf("can't update pack %s: %w", name, err)
+		}
+
+		revision, err := cs.packRevision(dir)
+		if err != nil {
+			return err
+		}
+
+		if revision == lock.Packs[idx].Revision {
+			fmt.Fprintf(cs.ioh.Stderr, "pack %s is up to date\n", name)
+			continue
+		}
+		fmt.Fprintf(cs.ioh.Stderr, "pack %s is updated from %s to %s\n", name, lock.Packs[idx].Revision, revision)
+		lock.Packs[idx].Revision = revision
+	}
+	return nil
+}
+
+func (cs *CliState) packRemove(lock *PacksLock, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("pack %s needs pack names", PackRemove)
+	}
+
+	for _, name := range names {
+		idx := lock.find(name)
+		if idx == -1 {
+			return fmt.Errorf("pack %s is not installed", name)
+		}
+
+		if err := cs.ioh.RemoveAll(cs.packDir(name)); err != nil {
+			return err
+		}
+		lock.Packs = slices.Delete(lock.Packs, idx, idx+1)
+		fmt.Fprintf(cs.ioh.Stderr, "pack %s is removed\n", name)
+	}
+	return nil
+}
+
+func (cs *CliState) packDir(name string) string {
+	return filepath.Join(cs.storage.Dir(), PacksDir, name)
+}
+
+// packRevision returns the commit, which is checked out in the pack's
+// directory
+func (cs *CliState) packRevision(dir string) (string, error) {
+	output, err := cs.ioh.captureCommand("git", "-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("can't get revision of %s: %w", dir, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// git runs git command in dir for test repositories
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+}
+
+// commitTemplate writes template into the working copy and pushes it into
+// the bare repository
+func commitTemplate(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "--quiet", "-m", "update "+name)
+	git(t, dir, "push", "--quiet", "origin", "HEAD")
+}
+
+func TestPacks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "company.git")
+	work := filepath.Join(root, "work")
+	templates := filepath.Join(root, "templates")
+	git(t, root, "init", "--quiet", "--bare", bare)
+	git(t, root, "clone", "--quiet", bare, work)
+	commitTemplate(t, work, "LICENSE/mit", "MIT {NAME}\n")
+	if err := os.MkdirAll(filepath.Join(templates, "LICENSE"), 0o755); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	// the same path as in the pack
+	if err := os.WriteFile(filepath.Join(templates, "LICENSE", "mit"), []byte("local\n"), 0o644); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	ioh := DefaultIOHandler()
+	ioh.Stdout = &stdout
+	ioh.Stderr = &stderr
+	ioh.LookupEnv = func(key string) (string, bool) {
+		return "Alice", true
+	}
+
+	run := func(command string, args ...string) {
+		t.Helper()
+		storage, readOnly, err := openStorage(ioh, templates)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		cliState := CliState{
+			command:       command,
+			templateNames: args,
+			storage:       storage,
+			readOnly:      readOnly,
+			ioh:           ioh,
+		}
+		if err := cliState.Run(); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+	}
+
+	run(PackCommand, PackAdd, bare)
+	run("", "company/mit", "LICENSE/mit")
+	if stdout.String() != "MIT Alice\nlocal\n" {
+		t.Fatalf("wrong output: %q", stdout.String())
+	}
+	stdout.Reset()
+
+	lock, err := readPacksLock(os.DirFS(templates))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(lock.Packs) != 1 || lock.Packs[0].Name != "company" || lock.Packs[0].Source != bare {
+		t.Fatalf("wrong lockfile: %#v", lock)
+	}
+	revision := lock.Packs[0].Revision
+
+	commitTemplate(t, work, "LICENSE/mit", "MIT License {NAME}\n")
+	run(PackCommand, PackUpdate)
+	run("", "company/mit")
+	if stdout.String() != "MIT License Alice\n" {
+		t.Fatalf("wrong output after update: %q", stdout.String())
+	}
+
+	lock, err = readPacksLock(os.DirFS(templates))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if lock.Packs[0].Revision == revision {
+		t.Fatalf("revision was not updated in the lockfile")
+	}
+
+	run(PackCommand, PackRemove, "company")
+	if _, err := os.Stat(filepath.Join(templates, PacksDir, "company")); !os.IsNotExist(err) {
+		t.Fatalf("pack directory should be removed, but got: %v", err)
+	}
+	storage, _, err := openStorage(ioh, templates)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if _, err := storage.Lookup("company/mit"); err == nil {
+		t.Fatalf("templates of removed pack should not be available")
+	}
+}
+
+func TestPackName(t *testing.T) {
+	testCases := []struct {
+		source string
+		expect string
+	}{
+		{"https://example.com/company/templates.git", "templates"},
+		{"git@example.com:templates.git", "templates"},
+		{"/srv/git/company/", "company"},
+		{"company", "company"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.source, func(t *testing.T) {
+			if name := packName(tt.source); name != tt.expect {
+				t.Fatalf("expected %q, but got %q", tt.expect, name)
+			}
+		})
+	}
+}
+
+func TestMissingPacks(t *testing.T) {
+	templates := t.TempDir()
+	var stderr bytes.Buffer
+	ioh := DefaultIOHandler()
+	ioh.Stderr = &stderr
+
+	run := func(args ...string) {
+		t.Helper()
+		storage, readOnly, err := openStorage(ioh, templates)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		cliState := CliState{
+			command:       PackCommand,
+			templateNames: args,
+			storage:       storage,
+			readOnly:      readOnly,
+			ioh:           ioh,
+		}
+		if err := cliState.Run(); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+	}
+
+	// nothing to update, but the lockfile can be written
+	run(PackUpdate)
+
+	// the pack's directory was removed by hand
+	lock := &PacksLock{Packs: []Pack{{Name: "company", Source: "company.git", Revision: "abc"}}}
+	if err := lock.save(ioh, templates); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	stderr.Reset()
+	run(PackRemove, "company")
+	if !strings.HasPrefix(stderr.String(), "pack company is skipped: ") {
+		t.Fatalf("expected warning about the missing pack, but got: %q", stderr.String())
+	}
+
+	lock, err := readPacksLock(os.DirFS(templates))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(lock.Packs) != 0 {
+		t.Fatalf("pack should be removed from the lockfile: %#v", lock)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/konyahin/sttemp/engine"
+)
+
+// SecretMask replaces values of secret variables in printed text
+const SecretMask = "********"
+
+// secretCommands returns commands, which print values of template's secret
+// variables
+func secretCommands(template *engine.Template) []string {
+	var commands []string
+	for _, name := range template.Variables {
+		if command := template.Metadata.Variable(name).SecretCommand; command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// readSecret returns value of the secret variable from its file or its
+// command, the trailing new line is removed
+func (cs *CliState) readSecret(variable engine.VariableMetadata) (string, error) {
+	var content []byte
+	var err error
+	if variable.SecretFile != "" {
+		var path string
+		path, err = expandHome(cs.ioh, variable.SecretFile)
+		if err == nil {
+			content, err = cs.ioh.ReadFile(path)
+		}
+	} else {
+		content, err = cs.ioh.captureCommand("sh", "-c", variable.SecretCommand)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", variable.Name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// expandHome replaces ~ at the start of the path with the home directory
+func expandHome(ioh *IOHandler, path string) (string, error) {
+	rest, found := strings.CutPrefix(path, "~/")
+	if !found {
+		return path, nil
+	}
+	home, err := ioh.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, rest), nil
+}
+
+// maskSecrets replaces values of template's secret variables and variables
+// derived from them in the text, values changed by filters are not replaced
+func maskSecrets(template *engine.Template, values map[string]string, text string) string {
+	var secrets []string
+	for name, value := range values {
+		if value != "" && template.IsSecret(name) {
+			secrets = append(secrets, value)
+		}
+	}
+
+	// longer values go first, so a value, which starts with another
+	// value, is masked entirely
+	slices.SortFunc(secrets, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+	var replacements []string
+	for _, secret := range secrets {
+		replacements = append(replacements, secret, SecretMask)
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
@@ -1,38 +1,57 @@
 package main
 
 import (
-	"errors"
-	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
-	"strings"
+
+	"github.com/konyahin/sttemp/engine"
 )
 
-var ErrDuplicateTemplate = errors.New("duplicate template names")
+// BundledTemplatesName is shown as the storage path, when templates are
+// built into the binary
+const BundledTemplatesName = "bundled"
 
-// Storage represent a directory with all templates
-type Storage struct {
-	path      string
-	templates map[string]TemplateFile
-}
+// bundledTemplates are built into the binary, see bundle.go. If they are
+// set, they are used instead of the default template directory.
+var bundledTemplates fs.FS
+
+// openStorage finds all templates in the directory or archive, by default
+// it is GetDefaultTemplateDir inside user's home directory. Templates from
+// archive or bundle are read-only.
+func openStorage(ioh *IOHandler, path string) (*engine.Storage, bool, error) {
+	fsys, dir, readOnly, err := storageFS(ioh, path)
+	if err != nil {
+		return nil, false, err
+	}
 
-func NewStorage(ioh *IOHandler, path string) (*Storage, error) {
-	path, err := getStoragePath(ioh, path)
+	storage, err := engine.NewStorage(fsys, dir)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	if err := mountPacks(storage, fsys, ioh.Stderr); err != nil {
+		return nil, false, err
+	}
+	return storage, readOnly, nil
+}
+
+// storageFS returns file system with templates and its path
+func storageFS(ioh *IOHandler, path string) (fsys fs.FS, dir string, readOnly bool, err error) {
+	if path == "" && bundledTemplates != nil {
+		return bundledTemplates, BundledTemplatesName, true, nil
 	}
 
-	templateFiles, err := findTemplateFiles(ioh, path)
+	path, err = getStoragePath(ioh, path)
 	if err != nil {
-		return nil, err
+		return nil, "", false, err
 	}
 
-	storage := &Storage{
-		path:      path,
-		templates: templateFiles,
+	if isArchive(path) {
+		fsys, err := openArchive(ioh, path)
+		return fsys, path, true, err
 	}
-	return storage, nil
+
+	return ioh.DirFS(path), path, false, nil
 }
 
 func GetDefaultTemplateDir() string {
@@ -54,38 +73,3 @@ func getStoragePath(ioh *IOHandler, path string) (string, error) {
 	}
 	return absPath, nil
 }
-
-func findTemplateFiles(ioh *IOHandler, path string) (map[string]TemplateFile, error) {
-	templateFiles := make(map[string]TemplateFile)
-	err := ioh.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
-		if err != nil {
-			if os.IsPermission(err) {
-				return nil
-			}
-			return err
-		}
-
-		if d.IsDir() && strings.HasPrefix(d.Name(), ".") {
-			return fs.SkipDir
-		}
-
-		if !d.IsDir() {
-			templateFile, err := NewTemplateFile(filePath, path)
-			if err != nil {
-				return err
-			}
-			if old, ok := templateFiles[templateFile.Name]; ok {
-				return fmt.Errorf("%w: %s and %s", ErrDuplicateTemplate, old.Path, templateFile.Path)
-			}
-			templateFiles[templateFile.Name] = *templateFile
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return templateFiles, nil
-}
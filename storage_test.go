@@ -1,41 +1,17 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"io/fs"
-	"os"
-	"reflect"
 	"testing"
-)
-
-type Dir struct {
-	// path to file/dir in file system
-	path string
-	// name of the file/dir
-	name string
-	// is it dir?
-	isDir bool
-	// error from the system when we try to access file
-	err error
-}
-
-func (d Dir) Name() string {
-	return d.name
-}
-
-func (d Dir) IsDir() bool {
-	return d.isDir
-}
+	"testing/fstest"
 
-// should be unused in code
-func (d Dir) Type() fs.FileMode {
-	return 0
-}
-
-// should be unused in code
-func (d Dir) Info() (fs.FileInfo, error) {
-	return nil, nil
-}
+	"github.com/konyahin/sttemp/engine"
+)
 
 func TestStorageTemplateDir(t *testing.T) {
 	testCases := []struct {
@@ -88,12 +64,12 @@ func TestStorageTemplateDir(t *testing.T) {
 				UserHomeDir: func() (string, error) {
 					return "HOME_DIR", tt.userHomeDirErr
 				},
-				WalkDir: func(root string, fn fs.WalkDirFunc) error {
-					return nil
+				DirFS: func(dir string) fs.FS {
+					return fstest.MapFS{}
 				},
 			}
 
-			storage, err := NewStorage(ioh, tt.path)
+			storage, _, err := openStorage(ioh, tt.path)
 			if !errors.Is(err, tt.wantError) {
 				t.Fatalf("err should be \"%v\", but we got \"%v\"", tt.wantError, err)
 			}
@@ -102,168 +78,130 @@ func TestStorageTemplateDir(t *testing.T) {
 				t.Error("storage should be nil when error is returned")
 			}
 
-			if tt.wantError == nil && storage.path != tt.wantPath {
-				t.Fatalf("storage directory should be \"%v\", but we got \"%v\"", tt.wantPath, storage.path)
+			if tt.wantError == nil && storage.Dir() != tt.wantPath {
+				t.Fatalf("storage directory should be \"%v\", but we got \"%v\"", tt.wantPath, storage.Dir())
 			}
 		})
 	}
 }
 
-func TestStorageTemplates(t *testing.T) {
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		file.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		writer.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStorageArchive(t *testing.T) {
+	files := map[string]string{
+		"./.sttemp":     "[NAME]\ndefault: Alice\n",
+		"./LICENSE/mit": "Copyright {NAME}\n",
+	}
+
 	testCases := []struct {
-		name   string
-		walk   []Dir
-		expect map[string]TemplateFile
-		err    error
+		name    string
+		path    string
+		archive []byte
 	}{
 		{
-			name:   "empty directory",
-			walk:   []Dir{},
-			expect: map[string]TemplateFile{},
-			err:    nil,
-		},
-		{
-			name: "happy path",
-			walk: []Dir{
-				{
-					path:  "/templates/first",
-					name:  "first",
-					isDir: false,
-					err:   nil,
-				},
-				{
-					path:  "/templates/LICENSE",
-					name:  "LICENSE",
-					isDir: true,
-					err:   nil,
-				},
-				{
-					path:  "/templates/LICENSE/mit",
-					name:  "mit",
-					isDir: false,
-					err:   nil,
-				},
-				{
-					path:  "/templates/LICENSE/gpl",
-					name:  "gpl",
-					isDir: false,
-					err:   nil,
-				},
-			},
-			expect: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/templates/first",
-				},
-				"mit": {
-					Name:        "mit",
-					DefaultName: "LICENSE",
-					Path:        "/templates/LICENSE/mit",
-				},
-				"gpl": {
-					Name:        "gpl",
-					DefaultName: "LICENSE",
-					Path:        "/templates/LICENSE/gpl",
-				},
-			},
-			err: nil,
-		},
-		{
-			name: "skip hidden dir",
-			walk: []Dir{
-				{
-					path:  "/templates/.config",
-					name:  ".config",
-					isDir: true,
-					err:   nil,
-				},
-			},
-			expect: nil,
-			err:    fs.SkipDir,
-		},
-		{
-			name: "return fs errors as is (except permissions errors)",
-			walk: []Dir{
-				{
-					path:  "/templates/first",
-					name:  "first",
-					isDir: false,
-					err:   fs.ErrInvalid,
-				},
-			},
-			expect: nil,
-			err:    fs.ErrInvalid,
-		},
-		{
-			name: "ignore permissions errors",
-			walk: []Dir{
-				{
-					path:  "/templates/first",
-					name:  "first",
-					isDir: false,
-					err:   nil,
-				},
-				{
-					path:  "/templates/second",
-					name:  "second",
-					isDir: false,
-					err:   os.ErrPermission,
-				},
-			},
-			expect: map[string]TemplateFile{
-				"first": {
-					Name:        "first",
-					DefaultName: "",
-					Path:        "/templates/first",
-				},
-			},
-			err: nil,
+			name:    "zip archive",
+			path:    "/templates.zip",
+			archive: zipArchive(t, map[string]string{".sttemp": files["./.sttemp"], "LICENSE/mit": files["./LICENSE/mit"]}),
 		},
 		{
-			name: "two templates with the same name",
-			walk: []Dir{
-				{
-					path:  "/templates/first",
-					name:  "first",
-					isDir: false,
-					err:   nil,
-				},
-				{
-					path:  "/templates/subdir/first",
-					name:  "first",
-					isDir: false,
-					err:   nil,
-				},
-			},
-			expect: nil,
-			err:    ErrDuplicateTemplate,
+			name:    "tar.gz archive",
+			path:    "/templates.tar.gz",
+			archive: tarArchive(t, files),
 		},
 	}
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			ioh := &IOHandler{
-				WalkDir: func(root string, fn fs.WalkDirFunc) error {
-					for _, walk := range tt.walk {
-						err := fn(walk.path, walk, walk.err)
-						if err != nil {
-							return err
-						}
+				ReadFile: func(name string) ([]byte, error) {
+					if name != tt.path {
+						return nil, fs.ErrNotExist
 					}
-					return nil
+					return tt.archive, nil
 				},
 			}
 
-			storage, err := NewStorage(ioh, "/templates")
+			storage, readOnly, err := openStorage(ioh, tt.path)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !readOnly {
+				t.Fatalf("templates from archive should be read-only")
+			}
 
-			if !errors.Is(err, tt.err) {
-				t.Fatalf("err should be \n%v\nbut we got\n%v\n", tt.err, err)
+			templateFile, err := storage.Lookup("mit")
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if templateFile.DefaultName != "LICENSE" || templateFile.Path != tt.path+"/LICENSE/mit" {
+				t.Fatalf("wrong template file: %#v", templateFile)
 			}
 
-			if tt.err == nil && !reflect.DeepEqual(tt.expect, storage.templates) {
-				t.Fatalf("Storage should contain\n%#v\nbut we got %#v\n", tt.expect, storage.templates)
+			var result bytes.Buffer
+			err = storage.Execute(&result, "mit", func(variable engine.VariableMetadata) (string, error) {
+				return variable.Default, nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if result.String() != "Copyright Alice\n" {
+				t.Fatalf("wrong result: %q", result.String())
 			}
 		})
 	}
 }
+
+func TestBundledTemplates(t *testing.T) {
+	bundledTemplates = fstest.MapFS{
+		"LICENSE/mit": {Data: []byte("Copyright {NAME}\n")},
+	}
+	defer func() { bundledTemplates = nil }()
+
+	storage, readOnly, err := openStorage(&IOHandler{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !readOnly {
+		t.Fatalf("bundled templates should be read-only")
+	}
+	if _, err := storage.Lookup("mit"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if storage.Dir() != BundledTemplatesName {
+		t.Fatalf("wrong storage directory: %s", storage.Dir())
+	}
+}